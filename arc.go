@@ -0,0 +1,167 @@
+package cache
+
+import "container/list"
+
+const (
+	arcT1 uint8 = iota
+	arcT2
+	arcB1
+	arcB2
+)
+
+type arcEntry[K comparable] struct {
+	key  K
+	list uint8
+}
+
+// arcPolicy implements the Adaptive Replacement Cache, see https://www.usenix.org/conference/fast-03/arc-self-tuning-low-overhead-replacement-cache
+// t1 holds the keys used once and t2 the keys used more than once. b1 and b2 remember the keys recently evicted from them,
+// and a hit on those ghost keys moves the target size of t1 towards the list that would have kept the key.
+type arcPolicy[K comparable] struct {
+	capacity       int
+	p              int
+	t1, t2, b1, b2 *list.List
+	elems          map[K]*list.Element
+	// victim is the last key returned by Victim, it is remembered in a ghost list once deleted.
+	victim    K
+	hasVictim bool
+}
+
+// NewARCPolicy returns an EvictionPolicy balancing recency and frequency with the Adaptive Replacement Cache algorithm.
+// capacity is the number of keys the shard holds, when 0 the number of tracked keys is used.
+func NewARCPolicy(capacity int) EvictionPolicy {
+	return newARCPolicy[string](capacity)
+}
+
+func newARCPolicy[K comparable](capacity int) *arcPolicy[K] {
+	return &arcPolicy[K]{
+		capacity: capacity,
+		t1:       list.New(),
+		t2:       list.New(),
+		b1:       list.New(),
+		b2:       list.New(),
+		elems:    make(map[K]*list.Element, 2*capacity),
+	}
+}
+
+func (p *arcPolicy[K]) OnAccess(k K) {
+	e, ok := p.elems[k]
+	if !ok {
+		return
+	}
+	switch e.Value.(*arcEntry[K]).list {
+	case arcT1:
+		p.move(e, arcT2)
+	case arcT2:
+		p.t2.MoveToFront(e)
+	}
+}
+
+func (p *arcPolicy[K]) OnInsert(k K) {
+	e, ok := p.elems[k]
+	if !ok {
+		p.elems[k] = p.t1.PushFront(&arcEntry[K]{key: k, list: arcT1})
+		p.trim()
+		return
+	}
+	switch e.Value.(*arcEntry[K]).list {
+	case arcB1:
+		p.p = minInt(p.c(), p.p+maxInt(1, p.b2.Len()/p.b1.Len()))
+		p.move(e, arcT2)
+	case arcB2:
+		p.p = maxInt(0, p.p-maxInt(1, p.b1.Len()/p.b2.Len()))
+		p.move(e, arcT2)
+	default:
+		p.OnAccess(k)
+	}
+	p.trim()
+}
+
+func (p *arcPolicy[K]) OnDelete(k K) {
+	e, ok := p.elems[k]
+	if !ok {
+		return
+	}
+	entry := e.Value.(*arcEntry[K])
+	if p.hasVictim && k == p.victim && (entry.list == arcT1 || entry.list == arcT2) {
+		var zero K
+		p.victim, p.hasVictim = zero, false
+		if entry.list == arcT1 {
+			p.move(e, arcB1)
+		} else {
+			p.move(e, arcB2)
+		}
+		p.trim()
+		return
+	}
+	p.list(entry.list).Remove(e)
+	delete(p.elems, k)
+}
+
+func (p *arcPolicy[K]) Victim() (K, bool) {
+	var e *list.Element
+	if p.t1.Len() > 0 && (p.t1.Len() > p.p || p.t2.Len() == 0) {
+		e = p.t1.Back()
+	} else {
+		e = p.t2.Back()
+	}
+	if e == nil {
+		var zero K
+		return zero, false
+	}
+	p.victim, p.hasVictim = e.Value.(*arcEntry[K]).key, true
+	return p.victim, true
+}
+
+// c returns the target number of resident keys.
+func (p *arcPolicy[K]) c() int {
+	if p.capacity > 0 {
+		return p.capacity
+	}
+	return maxInt(1, p.t1.Len()+p.t2.Len())
+}
+
+// trim forgets the oldest ghost keys so that t1+b1 holds at most c keys, and all lists at most 2c keys.
+func (p *arcPolicy[K]) trim() {
+	c := p.c()
+	for p.t1.Len()+p.b1.Len() > c && p.b1.Len() > 0 {
+		delete(p.elems, p.b1.Remove(p.b1.Back()).(*arcEntry[K]).key)
+	}
+	for p.t1.Len()+p.t2.Len()+p.b1.Len()+p.b2.Len() > 2*c && p.b2.Len() > 0 {
+		delete(p.elems, p.b2.Remove(p.b2.Back()).(*arcEntry[K]).key)
+	}
+}
+
+func (p *arcPolicy[K]) move(e *list.Element, to uint8) {
+	entry := e.Value.(*arcEntry[K])
+	p.list(entry.list).Remove(e)
+	entry.list = to
+	p.elems[entry.key] = p.list(to).PushFront(entry)
+}
+
+func (p *arcPolicy[K]) list(l uint8) *list.List {
+	switch l {
+	case arcT1:
+		return p.t1
+	case arcT2:
+		return p.t2
+	case arcB1:
+		return p.b1
+	default:
+		return p.b2
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -1,17 +1,26 @@
 package cache
 
 import (
+	"context"
+	"fmt"
+	"math"
+	"math/bits"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type ICache interface {
 	//Set key to hold the string value. If key already holds a value, it is overwritten, regardless of its type.
-	//Any previous time to live associated with the key is discarded on successful SET operation.
+	//Any previous time to live associated with the key is discarded on successful SET operation, unless WithKeepTTL is given.
 	//Example:
 	//c.Set("demo", 1)
 	//c.Set("demo", 1, WithEx(10*time.Second))
 	//c.Set("demo", 1, WithEx(10*time.Second), WithNx())
+	//c.Set("demo", 2, WithKeepTTL())
 	Set(k string, v interface{}, opts ...SetIOption) bool
 	//Get the value of key.
 	//If the key does not exist the special value nil,false is returned.
@@ -19,13 +28,114 @@ type ICache interface {
 	//c.Get("demo") //nil, false
 	//c.Set("demo", "value")
 	//c.Get("demo") //"value", true
+	//When the cache has a Loader, see WithLoader, a missing key is loaded, stored and returned,
+	//and nil,false is returned if the loader fails.
 	Get(k string) (interface{}, bool)
+	//GetE Get the value of key, like Get, but reports why it is missing.
+	//Returns ErrNotFound if the key does not exist and cannot be loaded, or the error of the Loader.
+	//Example:
+	//c.GetE("demo") //nil, ErrNotFound
+	//c.Set("demo", "value")
+	//c.GetE("demo") //"value", nil
+	GetE(k string) (interface{}, error)
+	//MGet Get the values of keys. Keys which do not exist are missing from the returned map.
+	//When the cache has a Loader, missing keys are loaded, with a single call of LoadAll if it is a BulkLoader.
+	//Example:
+	//c.Set("demo1", "1")
+	//c.MGet("demo1", "demo2") //{"demo1": "1"}
+	MGet(keys ...string) map[string]interface{}
+	//MGetE Get the values of keys, like MGet, but reports the error of the Loader
+	//along with the values found so far.
+	//Example:
+	//c.MGetE("demo1", "demo2") //{"demo1": "1"}, nil
+	MGetE(keys ...string) (map[string]interface{}, error)
+	//MSet Set the keys to their values in kvs, with the same options for every key, as Set would one by one.
+	//Each shard is locked once for all its keys, but the keys of different shards are not set atomically.
+	//Return the number of keys that were set.
+	//Example:
+	//c.MSet(map[string]interface{}{"demo1": 1, "demo2": 2}, WithEx(10*time.Second)) //2
+	MSet(kvs map[string]interface{}, opts ...SetIOption) int
+	//MSetNX Set the keys to their values in kvs, only if none of them exists, atomically:
+	//either every key is set or none is. The options apply to every key, none is set if one of them fails.
+	//With WithWriteThrough the keys are written with a single WriteBatch, none is set if it fails.
+	//Example:
+	//c.MSetNX(map[string]interface{}{"demo1": 1, "demo2": 2}) //true
+	//c.MSetNX(map[string]interface{}{"demo2": 3, "demo3": 3}) //false, demo2 exists
+	MSetNX(kvs map[string]interface{}, opts ...SetIOption) bool
+	//GetOrLoad Get the value of key, or load it with loader when the key does not exist.
+	//The loaded value is set with the time to live returned by loader, 0 for no expiration, unless key was set during the load.
+	//Concurrent misses of the same key share a single call of loader, and its result or error.
+	//Returns ctx.Err() as soon as ctx is done, the loader itself is only canceled once every caller waiting for it gave up.
+	//Example:
+	//c.GetOrLoad(ctx, "demo", func(ctx context.Context) (interface{}, time.Duration, error) {
+	//	v, err := db.Query(ctx, "demo")
+	//	return v, 10 * time.Second, err
+	//})
+	GetOrLoad(ctx context.Context, k string, loader LoaderFunc) (interface{}, error)
+	//GetWithStale Get the value of key, and whether it is stale: past its soft expire time, see WithSoftEx.
+	//A stale value is reloaded in the background when the cache has a Loader.
+	//If the key does not exist the special value nil,false,false is returned.
+	//Example:
+	//c.Set("demo", "value", WithSoftEx(10*time.Second), WithStaleFor(time.Minute))
+	//c.GetWithStale("demo") //"value", false, true
+	//time.Sleep(10*time.Second)
+	//c.GetWithStale("demo") //"value", true, true
+	GetWithStale(k string) (interface{}, bool, bool)
+	//GetWithVersion Get the value of key and its version.
+	//The version changes every time a value is stored at key, see CompareAndSwap.
+	//If the key does not exist the special value nil,0,false is returned.
+	//Example:
+	//c.Set("demo", "value")
+	//c.GetWithVersion("demo") //"value", 1, true
+	GetWithVersion(k string) (interface{}, uint64, bool)
+	//CompareAndSwap Sets key to value only if its version is still the one returned by GetWithVersion.
+	//A version of 0 only sets the key if it does not exist.
+	//Return false if the key was modified, or an option did not pass.
+	//Example:
+	//v, version, _ := c.GetWithVersion("demo")
+	//c.CompareAndSwap("demo", version, compute(v)) //true unless "demo" was set in between
+	CompareAndSwap(k string, version uint64, v interface{}, opts ...SetIOption) bool
+	//CompareAndDelete Deletes key only if its version is still the one returned by GetWithVersion.
+	//Return false if the key was modified or does not exist.
+	//Example:
+	//_, version, _ := c.GetWithVersion("demo")
+	//c.CompareAndDelete("demo", version) //true unless "demo" was set in between
+	CompareAndDelete(k string, version uint64) bool
 	//GetSet Atomically sets key to value and returns the old value stored at key.
 	//Returns nil,false when key not exists.
 	//Example:
 	//c.GetSet("demo", 1) //nil,false
 	//c.GetSet("demo", 2) //1,true
 	GetSet(k string, v interface{}, opts ...SetIOption) (interface{}, bool)
+	//Compute Atomically replaces the value of key with the one returned by f.
+	//f receives the current value, exists is false when the key does not exist. If f returns keep false the key is deleted,
+	//otherwise the new value is set with the options, discarding the previous time to live like Set does unless WithKeepTTL is given.
+	//Returns the value stored at key afterwards, and whether the key exists.
+	//f runs while the shard holding the key is locked: it must be fast, and must not call the cache,
+	//even for other keys, or it may deadlock.
+	//Example:
+	//c.Compute("demo", func(old interface{}, exists bool) (interface{}, bool) {
+	//	if !exists {
+	//		return []string{"a"}, true
+	//	}
+	//	return append(old.([]string), "a"), true
+	//})
+	Compute(k string, f func(old interface{}, exists bool) (newV interface{}, keep bool), opts ...SetIOption) (interface{}, bool)
+	//ComputeIfAbsent Atomically sets key to the value returned by f, only if the key does not exist.
+	//If f returns keep false nothing is set. Returns the value stored at key afterwards, and whether the key exists.
+	//f follows the same rules as in Compute.
+	//Example:
+	//c.ComputeIfAbsent("demo", func() (interface{}, bool) { return 1, true }) //1, true
+	//c.ComputeIfAbsent("demo", func() (interface{}, bool) { return 2, true }) //1, true
+	ComputeIfAbsent(k string, f func() (newV interface{}, keep bool), opts ...SetIOption) (interface{}, bool)
+	//ComputeIfPresent Atomically replaces the value of key with the one returned by f, only if the key exists.
+	//If f returns keep false the key is deleted. Returns the value stored at key afterwards, and whether the key exists.
+	//f follows the same rules as in Compute.
+	//Example:
+	//c.ComputeIfPresent("demo", func(old interface{}) (interface{}, bool) { return old.(int) + 1, true }) //nil, false
+	//c.Set("demo", 1)
+	//c.ComputeIfPresent("demo", func(old interface{}) (interface{}, bool) { return old.(int) + 1, true }) //2, true
+	ComputeIfPresent(k string, f func(old interface{}) (newV interface{}, keep bool), opts ...SetIOption) (interface{}, bool)
 	//GetDel Get the value of key and delete the key.
 	//This command is similar to GET, except for the fact that it also deletes the key on success.
 	//Example:
@@ -77,6 +187,13 @@ type ICache interface {
 	//c.Set("demo", "1")
 	//c.Persist("demo") // true
 	Persist(k string) bool
+	//Touch Restarts the sliding expiration of key, see WithSlidingEx, and counts as a use for the eviction policy.
+	//Return false if the key not exist.
+	//Example:
+	//c.Touch("demo") // false
+	//c.Set("demo", "1", WithSlidingEx(10*time.Second))
+	//c.Touch("demo") // true
+	Touch(k string) bool
 	//Ttl Returns the remaining time to live of a key that has a timeout.
 	//Returns 0,false if the key does not exist or if the key exist but has no associated expire.
 	//Example:
@@ -85,6 +202,29 @@ type ICache interface {
 	//c.Set("demo", "1", WithEx(10*time.Second))
 	//c.Ttl("demo") // 10*time.Second,true
 	Ttl(k string) (time.Duration, bool)
+	//IncrBy Increments the number stored at key by delta, and returns the new value.
+	//If the key does not exist, it is set to delta as an int64. The type and the time to live of an existing value are preserved.
+	//Returns a *NotNumericError if the value is not an int, int8-64, uint, uint8-64, float32 or float64.
+	//The new value is returned converted to an int64: a float is truncated, and a uint or uint64 above math.MaxInt64 wraps around,
+	//while the value stored keeps its type. Use IncrByFloat for floats.
+	//Example:
+	//c.IncrBy("demo", 10) // 10, nil
+	//c.IncrBy("demo", 5) // 15, nil
+	//c.Set("demo", "a")
+	//c.IncrBy("demo", 5) // 0, *NotNumericError
+	IncrBy(k string, delta int64) (int64, error)
+	//DecrBy Decrements the number stored at key by delta, and returns the new value.
+	//It has the same semantic as IncrBy with -delta.
+	//Example:
+	//c.DecrBy("demo", 10) // -10, nil
+	DecrBy(k string, delta int64) (int64, error)
+	//IncrByFloat Increments the number stored at key by delta, and returns the new value.
+	//If the key does not exist, it is set to delta as a float64. A float32 stays a float32, an integer becomes a float64.
+	//The time to live of an existing value is preserved.
+	//Example:
+	//c.Set("demo", 10.5)
+	//c.IncrByFloat("demo", 0.1) // 10.6, nil
+	IncrByFloat(k string, delta float64) (float64, error)
 	// ToMap converts the current cache into a map with string keys and interface{} values.
 	// Where the keys are the field names (as strings) and the values are the corresponding data.
 	// Returns:
@@ -97,6 +237,67 @@ type ICache interface {
 	// when sleep(1*time.Second)
 	// c.ToMap() return {"b":"uu"}
 	ToMap() map[string]interface{}
+	//Len Returns the number of keys, excluding the expired ones which are not removed yet.
+	//It counts the keys of one shard at a time, so the result is not a snapshot under concurrent writes.
+	//Example:
+	//c.Set("a", 1)
+	//c.Set("b", 1, WithEx(1*time.Second))
+	//c.Len() //2
+	Len() int
+	//Keys Returns the keys matching the glob-style pattern, like the KEYS command of Redis:
+	//* matches any sequence, ? matches any character, [abc], [a-c] and [^abc] match a character of a set,
+	//and \ escapes the special meaning of the character after it.
+	//The shards are visited one at a time, so the result is not a snapshot under concurrent writes.
+	//Example:
+	//c.Set("user:1", 1)
+	//c.Set("user:2", 2)
+	//c.Keys("user:*") //["user:1", "user:2"]
+	//c.Keys("user:[^1]") //["user:2"]
+	Keys(pattern string) []string
+	//KeysWithPrefix Returns the keys starting with prefix, like Keys with the pattern prefix followed by *,
+	//without any escaping.
+	//Example:
+	//c.KeysWithPrefix("user:") //["user:1", "user:2"]
+	KeysWithPrefix(prefix string) []string
+	//Scan Iterates the keys incrementally, like the SCAN command of Redis: start with cursor 0,
+	//then call Scan again with the returned cursor until it returns 0.
+	//Every key present from the start to the end of the iteration is returned at least once,
+	//keys set or removed meanwhile may be returned or not, and a key may be returned more than once.
+	//match is a glob-style pattern like the one of Keys, "" matches every key.
+	//count is the number of keys visited by a call, 10 if it is not positive: a call may return fewer keys, even none.
+	//Only one shard is locked at a time, for at most count keys.
+	//Example:
+	//var cursor uint64
+	//for {
+	//	var keys []string
+	//	cursor, keys = c.Scan(cursor, "user:*", 100)
+	//	//...
+	//	if cursor == 0 {
+	//		break
+	//	}
+	//}
+	Scan(cursor uint64, match string, count int) (uint64, []string)
+	//Cost Returns the total cost of the key-value pairs held by the cache.
+	//The cost of a value is given by WithCost, or estimated by the Sizer when the cache is bounded by WithMaxCost.
+	//Example:
+	//c := NewMemCache(WithMaxCost(1024))
+	//c.Set("a", "value")
+	//c.Set("b", 1, WithCost(10))
+	//c.Cost() // 15
+	Cost() int64
+	//Flush Removes all keys.
+	//Example:
+	//c.Set("demo1", "1")
+	//c.Set("demo2", "1")
+	//c.Flush()
+	//c.Exists("demo1") //false
+	Flush()
+	//Close Stops the background goroutines of the cache, and writes the pending writes of WithWriteBehind to the Store.
+	//Returns the error of the Store if the last writes failed. The cache must not be used after Close.
+	//Example:
+	//c := NewMemCache(WithWriteBehind(store, time.Second, 100))
+	//defer c.Close()
+	Close() error
 }
 
 func NewMemCache(opts ...ICacheOption) ICache {
@@ -104,16 +305,55 @@ func NewMemCache(opts ...ICacheOption) ICache {
 	for _, opt := range opts {
 		opt(conf)
 	}
+	cache := &MemCache{newMemCache[string](conf, nil)}
+	// Associated finalizer function with obj.
+	// When the obj is unreachable, close the obj.
+	runtime.SetFinalizer(cache, func(cache *MemCache) { cache.close() })
+	return cache
+}
 
-	c := &memCache{
-		shards:    make([]*memCacheShard, conf.shards),
+//newMemCache returns the cache of K keys shared by MemCache and Cache, zero is the value IncrBy starts a missing key from, nil for an int64.
+//The background goroutines only reference the returned memCache, so that the finalizer of its wrapper can close it.
+func newMemCache[K comparable](conf *Config, zero interface{}) *memCache[K] {
+	shards := conf.shards
+	//Every shard owns at least one of the max entries, so a smaller budget uses fewer shards.
+	if conf.maxEntries > 0 && conf.maxEntries < shards {
+		shards = 1 << (bits.Len(uint(conf.maxEntries)) - 1)
+	}
+	c := &memCache[K]{
+		shards:    make([]*memCacheShard[K], shards),
 		closed:    make(chan struct{}),
-		shardMask: uint64(conf.shards - 1),
+		shardMask: uint64(shards - 1),
 		config:    conf,
-		hash:      conf.hash,
+		hash:      typed[Hasher[K]](conf.hash),
+		loader:    typed[LoaderOf[K, interface{}]](conf.loader),
+		zero:      zero,
+	}
+	if c.hash == nil {
+		c.hash = newDefaultHasher[K]()
+	}
+	c.self, _ = any(c).(ICache)
+	newPolicy := typed[func(capacity int) EvictionPolicyOf[K]](conf.newPolicy)
+	if newPolicy == nil {
+		newPolicy = func(capacity int) EvictionPolicyOf[K] {
+			return newEvictionPolicy(conf.policy, capacity, c.hash)
+		}
 	}
-	for i := 0; i < len(c.shards); i++ {
-		c.shards[i] = newMemCacheShard(conf)
+	callbacks := newCallbackDispatcher[K](conf, c.closed)
+	var store storeWriter[K]
+	if s := typed[StoreOf[K, interface{}]](conf.store); s != nil && conf.writeBehindInterval > 0 {
+		c.writeBehind = newWriteBehind(s, conf, c.closed)
+		store = c.writeBehind
+	} else if s != nil {
+		store = writeThrough[K]{store: s}
+	}
+	for i := 0; i < shards; i++ {
+		//The max entries are spread so that the shares of the shards add up to exactly conf.maxEntries.
+		maxEntries := conf.maxEntries / shards
+		if i < conf.maxEntries%shards {
+			maxEntries++
+		}
+		c.shards[i] = newMemCacheShard(conf, maxEntries, &c.cost, callbacks, store, newPolicy, uint64(conf.jitterSeed)+uint64(i))
 	}
 	if conf.clearInterval > 0 {
 		go func() {
@@ -131,118 +371,542 @@ func NewMemCache(opts ...ICacheOption) ICache {
 			}
 		}()
 	}
-	cache := &MemCache{c}
-	// Associated finalizer function with obj.
-	// When the obj is unreachable, close the obj.
-	runtime.SetFinalizer(cache, func(cache *MemCache) { close(cache.closed) })
-	return cache
+	return c
+}
+
+//typed returns x, an element of the Config adapted to the keys of the cache, or the zero T if it is not set.
+//It panics if x was given for another type of keys.
+func typed[T any](x interface{}) T {
+	if x == nil {
+		var zero T
+		return zero
+	}
+	t, ok := x.(T)
+	if !ok {
+		panic(fmt.Sprintf("cache: option of type %T does not match the key type of the cache", x))
+	}
+	return t
 }
 
 type MemCache struct {
-	*memCache
+	*memCache[string]
 }
 
-type memCache struct {
-	shards    []*memCacheShard
-	hash      IHash
+type memCache[K comparable] struct {
+	// cost is accessed atomically, keep it first for 64-bit alignment.
+	cost      int64
+	evictNext uint64
+	shards    []*memCacheShard[K]
+	hash      Hasher[K]
 	shardMask uint64
 	config    *Config
 	closed    chan struct{}
+	closeOnce sync.Once
+	loads     flightGroup[K]
+	// loader is the Loader given by WithLoader, nil for a cache which does not read through.
+	loader LoaderOf[K, interface{}]
+	// writeBehind is the queue of the writes to the Store, nil unless WithWriteBehind is given.
+	writeBehind *writeBehind[K]
+	// self is the cache passed to the SetIOption, nil unless the keys are strings.
+	self ICache
+	// zero is the value a missing key starts from in IncrBy, nil for an int64.
+	zero interface{}
 }
 
-func (c *memCache) Set(k string, v interface{}, opts ...SetIOption) bool {
+func (c *memCache[K]) Set(k K, v interface{}, opts ...SetIOption) bool {
+	return c.set(k, v, opts, true)
+}
+
+//set stores the value of key, and writes it to the Store if persist is true.
+func (c *memCache[K]) set(k K, v interface{}, opts []SetIOption, persist bool) bool {
 	item := Item{v: v}
-	for _, opt := range opts {
-		if pass := opt(c, k, &item); !pass {
-			return false
-		}
+	if c.config.maxCost > 0 {
+		item.cost = c.config.sizer.Size(v)
+	}
+	shard := c.getShard(k)
+	if !shard.set(c.self, k, &item, opts, persist) {
+		return false
+	}
+	if c.config.maxCost > 0 {
+		c.evictCost()
 	}
-	hashedKey := c.hash.Sum64(k)
-	shard := c.getShard(hashedKey)
-	shard.set(k, &item)
 	return true
 }
 
-func (c *memCache) Get(k string) (interface{}, bool) {
-	hashedKey := c.hash.Sum64(k)
-	shard := c.getShard(hashedKey)
+//evictCost evicts keys until the total cost fits in maxCost.
+//Shards are visited round-robin so that the evictions are spread over the whole cache,
+//each evicting the victim of its own policy, so the order is not LRU across shards.
+func (c *memCache[K]) evictCost() {
+	var empty int
+	for atomic.LoadInt64(&c.cost) > c.config.maxCost && empty < len(c.shards) {
+		i := atomic.AddUint64(&c.evictNext, 1)
+		if c.shards[i&c.shardMask].evictOne() {
+			empty = 0
+		} else {
+			empty++
+		}
+	}
+}
+
+func (c *memCache[K]) Get(k K) (interface{}, bool) {
+	if c.loader == nil {
+		return c.get(k)
+	}
+	v, err := c.GetE(k)
+	return v, err == nil
+}
+
+//get the value of key, without loading it.
+func (c *memCache[K]) get(k K) (interface{}, bool) {
+	shard := c.getShard(k)
 	return shard.get(k)
 }
 
-func (c *memCache) GetSet(k string, v interface{}, opts ...SetIOption) (interface{}, bool) {
-	defer c.Set(k, v, opts...)
-	return c.Get(k)
+//getItem the item of key, without loading it.
+func (c *memCache[K]) getItem(k K) (Item, bool) {
+	shard := c.getShard(k)
+	return shard.getItem(k)
+}
+
+func (c *memCache[K]) GetE(k K) (interface{}, error) {
+	if item, found := c.getItem(k); found {
+		if item.tombstone {
+			return nil, ErrNotFound
+		}
+		c.refresh(k, item)
+		return item.v, nil
+	}
+	if c.loader == nil {
+		return nil, ErrNotFound
+	}
+	return c.readThrough(context.Background(), k)
 }
 
-func (c *memCache) GetDel(k string) (interface{}, bool) {
-	defer c.Del(k)
-	return c.Get(k)
+func (c *memCache[K]) GetWithStale(k K) (interface{}, bool, bool) {
+	if item, found := c.getItem(k); found {
+		if item.tombstone {
+			return nil, false, false
+		}
+		c.refresh(k, item)
+		return item.v, item.Stale(), true
+	}
+	if c.loader == nil {
+		return nil, false, false
+	}
+	v, err := c.readThrough(context.Background(), k)
+	return v, false, err == nil
 }
 
-func (c *memCache) Del(ks ...string) int {
+func (c *memCache[K]) MGet(ks ...K) map[K]interface{} {
+	result, _ := c.MGetE(ks...)
+	return result
+}
+
+func (c *memCache[K]) MGetE(ks ...K) (map[K]interface{}, error) {
+	result := make(map[K]interface{}, len(ks))
+	var misses []int
+	found := func(i int, item Item) {
+		if !item.tombstone {
+			c.refresh(ks[i], item)
+			result[ks[i]] = item.v
+		}
+	}
+	missing := func(i int) {
+		misses = append(misses, i)
+	}
+	for _, g := range c.groupByShard(ks) {
+		c.shards[g.shard].getItems(ks, g.idx, found, missing)
+	}
+	if len(misses) == 0 || c.loader == nil {
+		return result, nil
+	}
+	sort.Ints(misses)
+	keys := make([]K, len(misses))
+	for i, j := range misses {
+		keys[i] = ks[j]
+	}
+	return result, c.loadAll(context.Background(), dedup(keys), result)
+}
+
+func (c *memCache[K]) MSet(kvs map[K]interface{}, opts ...SetIOption) int {
+	keys, items := c.newItems(kvs)
 	var count int
-	for _, k := range ks {
-		hashedKey := c.hash.Sum64(k)
-		shard := c.getShard(hashedKey)
-		count += shard.del(k)
+	for _, g := range c.groupByShard(keys) {
+		count += c.shards[g.shard].setAll(c.self, keys, items, g.idx, opts)
+	}
+	if count > 0 && c.config.maxCost > 0 {
+		c.evictCost()
+	}
+	return count
+}
+
+func (c *memCache[K]) MSetNX(kvs map[K]interface{}, opts ...SetIOption) bool {
+	keys, items := c.newItems(kvs)
+	groups := c.groupByShard(keys)
+	// The shards are locked in ascending order, so that concurrent calls cannot deadlock.
+	shards := make([]*memCacheShard[K], len(keys))
+	for _, g := range groups {
+		shard := c.shards[g.shard]
+		shard.lock.Lock()
+		for _, i := range g.idx {
+			shards[i] = shard
+		}
+	}
+	removals, ok := setAllNX(c.self, shards, keys, items, opts)
+	for _, g := range groups {
+		c.shards[g.shard].lock.Unlock()
+	}
+	if !ok {
+		return false
+	}
+	if len(groups) > 0 {
+		c.shards[groups[0].shard].notifyAll(removals)
+	}
+	if c.config.maxCost > 0 {
+		c.evictCost()
+	}
+	return true
+}
+
+//newItems returns the keys of kvs and the items holding their values.
+func (c *memCache[K]) newItems(kvs map[K]interface{}) ([]K, []Item) {
+	keys := make([]K, 0, len(kvs))
+	items := make([]Item, 0, len(kvs))
+	for k, v := range kvs {
+		item := Item{v: v}
+		if c.config.maxCost > 0 {
+			item.cost = c.config.sizer.Size(v)
+		}
+		keys = append(keys, k)
+		items = append(items, item)
+	}
+	return keys, items
+}
+
+//shardGroup is the indexes of the keys of a batch held by the same shard, see groupByShard.
+type shardGroup struct {
+	shard uint64
+	idx   []int
+}
+
+//groupByShard groups the indexes of keys by the shard holding them, in ascending order of shard,
+//so that a batch locks each shard once. The indexes of a group are in ascending order.
+func (c *memCache[K]) groupByShard(keys []K) []shardGroup {
+	shards := make([]uint64, len(keys))
+	// Counting sort: starts[s] is the position of the first key of shard s in order.
+	starts := make([]int, len(c.shards)+1)
+	for i, k := range keys {
+		shards[i] = c.hash.Sum64(k) & c.shardMask
+		starts[shards[i]+1]++
+	}
+	var groups []shardGroup
+	for s := 0; s < len(c.shards); s++ {
+		if starts[s+1] > 0 {
+			groups = append(groups, shardGroup{shard: uint64(s)})
+		}
+		starts[s+1] += starts[s]
+	}
+	order := make([]int, len(keys))
+	for i, s := range shards {
+		order[starts[s]] = i
+		starts[s]++
+	}
+	// Once filled, starts[s] is the end of the keys of shard s.
+	begin := 0
+	for g := range groups {
+		end := starts[groups[g].shard]
+		groups[g].idx = order[begin:end:end]
+		begin = end
+	}
+	return groups
+}
+
+func (c *memCache[K]) GetOrLoad(ctx context.Context, k K, loader LoaderFunc) (interface{}, error) {
+	if item, found := c.getItem(k); found {
+		if item.tombstone {
+			return nil, ErrNotFound
+		}
+		return item.v, nil
+	}
+	return c.load(ctx, k, loader)
+}
+
+func (c *memCache[K]) GetWithVersion(k K) (interface{}, uint64, bool) {
+	shard := c.getShard(k)
+	item, found := shard.getItem(k)
+	if !found || item.tombstone {
+		return nil, 0, false
+	}
+	return item.v, item.version, true
+}
+
+func (c *memCache[K]) CompareAndSwap(k K, version uint64, v interface{}, opts ...SetIOption) bool {
+	return c.compareAndSwap(k, version, v, opts, true)
+}
+
+//compareAndSwap stores the value of key if its version is still version, and writes it to the Store if persist is true.
+func (c *memCache[K]) compareAndSwap(k K, version uint64, v interface{}, opts []SetIOption, persist bool) bool {
+	item := Item{v: v}
+	if c.config.maxCost > 0 {
+		item.cost = c.config.sizer.Size(v)
+	}
+	shard := c.getShard(k)
+	if !shard.compareAndSwap(c.self, k, version, &item, opts, persist) {
+		return false
+	}
+	if c.config.maxCost > 0 {
+		c.evictCost()
+	}
+	return true
+}
+
+func (c *memCache[K]) CompareAndDelete(k K, version uint64) bool {
+	shard := c.getShard(k)
+	return shard.compareAndDelete(k, version)
+}
+
+func (c *memCache[K]) GetSet(k K, v interface{}, opts ...SetIOption) (interface{}, bool) {
+	item := Item{v: v}
+	if c.config.maxCost > 0 {
+		item.cost = c.config.sizer.Size(v)
+	}
+	shard := c.getShard(k)
+	old, found, stored := shard.getSet(c.self, k, &item, opts)
+	if stored && c.config.maxCost > 0 {
+		c.evictCost()
+	}
+	return old, found
+}
+
+func (c *memCache[K]) Compute(k K, f func(old interface{}, exists bool) (interface{}, bool), opts ...SetIOption) (interface{}, bool) {
+	return c.compute(k, computeAlways, f, opts)
+}
+
+func (c *memCache[K]) ComputeIfAbsent(k K, f func() (interface{}, bool), opts ...SetIOption) (interface{}, bool) {
+	return c.compute(k, computeIfAbsent, func(interface{}, bool) (interface{}, bool) { return f() }, opts)
+}
+
+func (c *memCache[K]) ComputeIfPresent(k K, f func(old interface{}) (interface{}, bool), opts ...SetIOption) (interface{}, bool) {
+	return c.compute(k, computeIfPresent, func(old interface{}, _ bool) (interface{}, bool) { return f(old) }, opts)
+}
+
+func (c *memCache[K]) compute(k K, mode computeMode, f func(old interface{}, exists bool) (interface{}, bool), opts []SetIOption) (interface{}, bool) {
+	shard := c.getShard(k)
+	v, exist := shard.compute(c.self, k, mode, f, opts)
+	if exist && c.config.maxCost > 0 {
+		c.evictCost()
+	}
+	return v, exist
+}
+
+func (c *memCache[K]) GetDel(k K) (interface{}, bool) {
+	shard := c.getShard(k)
+	return shard.getDel(k)
+}
+
+func (c *memCache[K]) Del(ks ...K) int {
+	if len(ks) == 1 {
+		return c.getShard(ks[0]).del(ks[0])
+	}
+	var count int
+	for _, g := range c.groupByShard(ks) {
+		count += c.shards[g.shard].delAll(ks, g.idx)
 	}
 	return count
 }
 
 //DelExpired Only delete when key expires
-func (c *memCache) DelExpired(k string) bool {
-	hashedKey := c.hash.Sum64(k)
-	shard := c.getShard(hashedKey)
+func (c *memCache[K]) DelExpired(k K) bool {
+	shard := c.getShard(k)
 	return shard.delExpired(k)
 }
 
-func (c *memCache) Exists(ks ...string) bool {
+func (c *memCache[K]) Exists(ks ...K) bool {
 	for _, k := range ks {
-		if _, found := c.Get(k); !found {
+		if _, found := c.get(k); !found {
 			return false
 		}
 	}
 	return true
 }
 
-func (c *memCache) Expire(k string, d time.Duration) bool {
-	v, found := c.Get(k)
-	if !found {
-		return false
-	}
-	return c.Set(k, v, WithEx(d))
+func (c *memCache[K]) Expire(k K, d time.Duration) bool {
+	return c.ExpireAt(k, time.Now().Add(d))
 }
 
-func (c *memCache) ExpireAt(k string, t time.Time) bool {
-	v, found := c.Get(k)
-	if !found {
-		return false
-	}
-	return c.Set(k, v, WithExAt(t))
+func (c *memCache[K]) ExpireAt(k K, t time.Time) bool {
+	shard := c.getShard(k)
+	return shard.expire(k, t)
 }
 
-func (c *memCache) Persist(k string) bool {
-	v, found := c.Get(k)
-	if !found {
-		return false
+func (c *memCache[K]) Persist(k K) bool {
+	shard := c.getShard(k)
+	return shard.expire(k, time.Time{})
+}
+
+func (c *memCache[K]) IncrBy(k K, delta int64) (int64, error) {
+	var n int64
+	err := c.update(k, func(v interface{}, exist bool) (interface{}, error) {
+		if !exist {
+			if c.zero == nil {
+				n = delta
+				return delta, nil
+			}
+			v = c.zero
+		}
+		nv, i, ok := addInt(v, delta)
+		if !ok {
+			return nil, &NotNumericError{Key: fmt.Sprint(k), Value: v}
+		}
+		n = i
+		return nv, nil
+	})
+	return n, err
+}
+
+func (c *memCache[K]) DecrBy(k K, delta int64) (int64, error) {
+	return c.IncrBy(k, -delta)
+}
+
+func (c *memCache[K]) IncrByFloat(k K, delta float64) (float64, error) {
+	var n float64
+	err := c.update(k, func(v interface{}, exist bool) (interface{}, error) {
+		if !exist {
+			if c.zero == nil {
+				n = delta
+				return delta, nil
+			}
+			v = c.zero
+		}
+		nv, f, ok := addFloat(v, delta)
+		if !ok {
+			return nil, &NotNumericError{Key: fmt.Sprint(k), Value: v}
+		}
+		n = f
+		return nv, nil
+	})
+	return n, err
+}
+
+//update atomically replaces the value of k with the one returned by f, see memCacheShard.update.
+func (c *memCache[K]) update(k K, f func(v interface{}, exist bool) (interface{}, error)) error {
+	shard := c.getShard(k)
+	if err := shard.update(k, f); err != nil {
+		return err
+	}
+	if c.config.maxCost > 0 {
+		c.evictCost()
 	}
-	return c.Set(k, v)
+	return nil
+}
+
+func (c *memCache[K]) Touch(k K) bool {
+	item, found := c.getItem(k)
+	return found && !item.tombstone
 }
 
-func (c *memCache) Ttl(k string) (time.Duration, bool) {
-	hashedKey := c.hash.Sum64(k)
-	shard := c.getShard(hashedKey)
+func (c *memCache[K]) Ttl(k K) (time.Duration, bool) {
+	shard := c.getShard(k)
 	return shard.ttl(k)
 }
 
-func (c *memCache) ToMap() map[string]interface{} {
-	result := make(map[string]interface{})
+func (c *memCache[K]) ToMap() map[K]interface{} {
+	result := make(map[K]interface{})
 	for _, shard := range c.shards {
 		shard.saveToMap(result)
 	}
 	return result
 }
 
-func (c *memCache) getShard(hashedKey uint64) (shard *memCacheShard) {
-	return c.shards[hashedKey&c.shardMask]
+func (c *memCache[K]) Len() int {
+	var n int
+	for _, shard := range c.shards {
+		n += shard.len()
+	}
+	return n
+}
+
+func (c *memCache[K]) Keys(pattern string) []K {
+	if prefix, ok := globPrefix(pattern); ok {
+		return c.KeysWithPrefix(prefix)
+	}
+	return c.keys(func(k string) bool { return matchGlob(pattern, k) })
+}
+
+func (c *memCache[K]) KeysWithPrefix(prefix string) []K {
+	return c.keys(func(k string) bool { return strings.HasPrefix(k, prefix) })
+}
+
+func (c *memCache[K]) Scan(cursor uint64, match string, count int) (uint64, []K) {
+	if match == "" {
+		return c.scan(cursor, count, func(K) bool { return true })
+	}
+	matchString := func(k string) bool { return matchGlob(match, k) }
+	if prefix, ok := globPrefix(match); ok {
+		matchString = func(k string) bool { return strings.HasPrefix(k, prefix) }
+	}
+	return c.scan(cursor, count, func(k K) bool {
+		s, ok := any(k).(string)
+		return ok && matchString(s)
+	})
+}
+
+//scan returns the keys accepted by match from cursor on, see Scan.
+//The cursor holds the index of a shard in its high 32 bits, and a slot of the scan order of the shard in its low 32 bits.
+func (c *memCache[K]) scan(cursor uint64, count int, match func(k K) bool) (uint64, []K) {
+	if count <= 0 {
+		count = 10
+	}
+	var keys []K
+	shard, pos := int(cursor>>32), int(cursor&math.MaxUint32)
+	for ; shard < len(c.shards); shard, pos = shard+1, 0 {
+		var visited int
+		keys, pos, visited = c.shards[shard].scan(keys, pos, count, match)
+		count -= visited
+		if pos >= 0 {
+			return uint64(shard)<<32 | uint64(pos), keys
+		}
+	}
+	return 0, keys
+}
+
+//keys returns the keys accepted by match, visiting one shard at a time. Keys which are not strings are never accepted.
+func (c *memCache[K]) keys(match func(k string) bool) []K {
+	accept := func(k K) bool {
+		s, ok := any(k).(string)
+		return ok && match(s)
+	}
+	keys := []K{}
+	for _, shard := range c.shards {
+		keys = shard.keys(keys, accept)
+	}
+	return keys
+}
+
+func (c *memCache[K]) Flush() {
+	for _, shard := range c.shards {
+		shard.flush()
+	}
+}
+
+func (c *memCache[K]) Cost() int64 {
+	return atomic.LoadInt64(&c.cost)
+}
+
+func (c *memCache[K]) Close() error {
+	c.close()
+	if c.writeBehind != nil {
+		return c.writeBehind.wait()
+	}
+	return nil
+}
+
+//close stops the background goroutines of the cache, they finish their pending work first.
+func (c *memCache[K]) close() {
+	c.closeOnce.Do(func() { close(c.closed) })
+}
+
+//getShard returns the shard holding key, chosen by the Hasher of the cache.
+func (c *memCache[K]) getShard(k K) (shard *memCacheShard[K]) {
+	return c.shards[c.hash.Sum64(k)&c.shardMask]
 }
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+const benchmarkBatch = 500
+
+// benchmarkKeySpace is the number of distinct keys written by the concurrent benchmarks.
+const benchmarkKeySpace = 1 << 16
+
+func benchmarkKeys() ([]string, map[string]interface{}) {
+	keys := make([]string, benchmarkBatch)
+	kvs := make(map[string]interface{}, benchmarkBatch)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		kvs[keys[i]] = i
+	}
+	return keys, kvs
+}
+
+func BenchmarkMemCache_MGet(b *testing.B) {
+	keys, kvs := benchmarkKeys()
+	c := NewMemCache(WithShards(16))
+	c.MSet(kvs)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.MGet(keys...)
+		}
+	})
+}
+
+func BenchmarkMemCache_GetLoop(b *testing.B) {
+	keys, kvs := benchmarkKeys()
+	c := NewMemCache(WithShards(16))
+	c.MSet(kvs)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			result := make(map[string]interface{}, len(keys))
+			for _, k := range keys {
+				if v, ok := c.Get(k); ok {
+					result[k] = v
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkMemCache_MSet(b *testing.B) {
+	_, kvs := benchmarkKeys()
+	c := NewMemCache(WithShards(16))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.MSet(kvs)
+		}
+	})
+}
+
+func BenchmarkMemCache_SetLoop(b *testing.B) {
+	_, kvs := benchmarkKeys()
+	c := NewMemCache(WithShards(16))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			for k, v := range kvs {
+				c.Set(k, v)
+			}
+		}
+	})
+}
+
+func BenchmarkGoCacheConcurrentSetWithEx(b *testing.B) {
+	c := NewMemCache()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			c.Set(strconv.Itoa(i&(benchmarkKeySpace-1)), i, WithEx(time.Minute))
+			i++
+		}
+	})
+}
+
+func BenchmarkGoCacheConcurrentSet(b *testing.B) {
+	c := NewMemCache()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			c.Set(strconv.Itoa(i&(benchmarkKeySpace-1)), i)
+			i++
+		}
+	})
+}
+
+func BenchmarkGoCacheConcurrentGet(b *testing.B) {
+	c := NewMemCache()
+	keys := make([]string, benchmarkKeySpace)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		c.Set(keys[i], i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			c.Get(keys[i&(benchmarkKeySpace-1)])
+			i++
+		}
+	})
+}
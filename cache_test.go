@@ -1,9 +1,16 @@
 package cache
 
 import (
+	"context"
+	"errors"
+	"math"
 	"os"
 	"reflect"
 	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -51,6 +58,30 @@ func TestItem_Expired(t *testing.T) {
 	}
 }
 
+func TestItem_Stale(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		soft   time.Time
+		expire time.Time
+		want   bool
+	}{
+		{name: "no soft", expire: now.Add(time.Second), want: false},
+		{name: "fresh", soft: now.Add(time.Second), expire: now.Add(2 * time.Second), want: false},
+		{name: "stale", soft: now.Add(-time.Second), expire: now.Add(time.Second), want: true},
+		{name: "stale forever", soft: now.Add(-time.Second), want: true},
+		{name: "expired", soft: now.Add(-2 * time.Second), expire: now.Add(-time.Second), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &Item{v: 1, expire: tt.expire, extra: &itemExtra{soft: tt.soft}}
+			if got := i.Stale(); got != tt.want {
+				t.Errorf("Stale() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestMemCache_Del(t *testing.T) {
 	type args struct {
 		ks []string
@@ -340,6 +371,34 @@ func TestMemCache_Ttl(t *testing.T) {
 	}
 }
 
+func TestMemCache_Touch(t *testing.T) {
+	tests := []struct {
+		name    string
+		k       string
+		sleep   time.Duration
+		want    bool
+		wantTtl time.Duration
+	}{
+		{name: "int", k: "int", want: true},
+		{name: "null", k: "null", want: false},
+		{name: "ex", k: "ex", sleep: 50 * time.Millisecond, want: true, wantTtl: 950 * time.Millisecond},
+		{name: "sliding", k: "sliding", sleep: 50 * time.Millisecond, want: true, wantTtl: 1 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockCache()
+			c.Set("sliding", 1, WithSlidingEx(1*time.Second))
+			time.Sleep(tt.sleep)
+			if got := c.Touch(tt.k); got != tt.want {
+				t.Errorf("Touch() = %v, want %v", got, tt.want)
+			}
+			if got, _ := c.Ttl(tt.k); got > tt.wantTtl || tt.wantTtl-got > 10*time.Millisecond {
+				t.Errorf("Ttl() = %v, want %v", got, tt.wantTtl)
+			}
+		})
+	}
+}
+
 func TestMemCache_DelExpired(t *testing.T) {
 	type args struct {
 		k     string
@@ -422,3 +481,911 @@ func TestMemCache_Finalize(t *testing.T) {
 		})
 	}
 }
+
+func TestMemCache_Flush(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ICacheOption
+	}{
+		{name: "base"},
+		{name: "bounded", opts: []ICacheOption{WithMaxEntries(10), WithMaxCost(1024)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockCache(tt.opts...)
+			c.Flush()
+			if got := c.ToMap(); len(got) != 0 {
+				t.Errorf("Flush() left %v", got)
+			}
+			if got := c.Cost(); got != 0 {
+				t.Errorf("Cost() = %v, want %v", got, 0)
+			}
+			c.Set("a", 1)
+			if got, _ := c.Get("a"); got != 1 {
+				t.Errorf("Get() after Flush() = %v, want %v", got, 1)
+			}
+		})
+	}
+}
+
+func TestMemCache_ExpireAtPast(t *testing.T) {
+	var reasons []RemovalReason
+	rl := func(k string, v interface{}, reason RemovalReason) error {
+		reasons = append(reasons, reason)
+		return nil
+	}
+	c := mockCache(WithRemovalListener(rl))
+	if got := c.ExpireAt("int", time.Now().Add(-1*time.Second)); got != true {
+		t.Errorf("ExpireAt() = %v, want %v", got, true)
+	}
+	if _, got := c.Get("int"); got != false {
+		t.Errorf("Get() got1 = %v, want %v", got, false)
+	}
+	c.Expire("string", 1*time.Second)
+	c.Persist("string")
+	if !reflect.DeepEqual(reasons, []RemovalReason{Expired}) {
+		t.Errorf("RemovalListener() reasons = %v, want %v", reasons, []RemovalReason{Expired})
+	}
+}
+
+func TestMemCache_ExpireConcurrentDel(t *testing.T) {
+	c := NewMemCache()
+	for i := 0; i < 1000; i++ {
+		c.Set("k", i)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			c.Del("k")
+		}()
+		go func() {
+			defer wg.Done()
+			c.Expire("k", 1*time.Minute)
+		}()
+		wg.Wait()
+		if v, ok := c.Get("k"); ok {
+			t.Fatalf("Get() = %v, %v after Del(), want key deleted", v, ok)
+		}
+	}
+}
+
+func TestMemCache_GetSetConcurrent(t *testing.T) {
+	const goroutines, sets = 50, 200
+	c := NewMemCache()
+	c.Set("k", -1)
+	returned := make(chan interface{}, goroutines*sets)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < sets; i++ {
+				if old, ok := c.GetSet("k", g*sets+i); ok {
+					returned <- old
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(returned)
+	seen := map[interface{}]int{}
+	for v := range returned {
+		seen[v]++
+	}
+	last, _ := c.Get("k")
+	seen[last]++
+	// Every value, the initial one included, is returned exactly once, or is the value left in the cache.
+	if len(seen) != goroutines*sets+1 {
+		t.Errorf("GetSet() returned %v distinct values, want %v", len(seen), goroutines*sets+1)
+	}
+	for v, n := range seen {
+		if n != 1 {
+			t.Errorf("GetSet() returned %v %v times, want once", v, n)
+		}
+	}
+}
+
+func TestMemCache_GetDelConcurrent(t *testing.T) {
+	const goroutines, values = 50, 2000
+	c := NewMemCache()
+	returned := make(chan interface{}, values)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if v, ok := c.GetDel("k"); ok {
+					returned <- v
+				} else {
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+	for i := 0; i < values; i++ {
+		for !c.Set("k", i, WithNx()) {
+			runtime.Gosched()
+		}
+	}
+	for c.Exists("k") {
+		runtime.Gosched()
+	}
+	close(done)
+	wg.Wait()
+	close(returned)
+	seen := map[interface{}]int{}
+	for v := range returned {
+		seen[v]++
+	}
+	if len(seen) != values {
+		t.Errorf("GetDel() returned %v distinct values, want %v", len(seen), values)
+	}
+	for v, n := range seen {
+		if n != 1 {
+			t.Errorf("GetDel() returned %v %v times, want once", v, n)
+		}
+	}
+}
+
+func TestMemCache_IncrBy(t *testing.T) {
+	type args struct {
+		k     string
+		delta int64
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    int64
+		wantV   interface{}
+		wantErr bool
+	}{
+		{name: "int", args: args{k: "int", delta: 2}, want: 3, wantV: 3},
+		{name: "int32", args: args{k: "int32", delta: -2}, want: -1, wantV: int32(-1)},
+		{name: "int64", args: args{k: "int64", delta: 10}, want: 11, wantV: int64(11)},
+		{name: "float64", args: args{k: "float64", delta: 1}, want: 2, wantV: 2.1},
+		{name: "uint8", args: args{k: "uint8", delta: 1}, want: 0, wantV: uint8(0)},
+		{name: "float64 truncated", args: args{k: "float", delta: 1}, want: 2, wantV: 2.5},
+		{name: "uint64 wrapped", args: args{k: "uint64", delta: 1}, want: math.MinInt64, wantV: uint64(math.MaxInt64 + 1)},
+		{name: "null", args: args{k: "null", delta: 5}, want: 5, wantV: int64(5)},
+		{name: "string", args: args{k: "string", delta: 1}, want: 0, wantV: "a", wantErr: true},
+	}
+	c := mockCache()
+	c.Set("uint8", uint8(255))
+	c.Set("float", 1.5)
+	c.Set("uint64", uint64(math.MaxInt64))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.IncrBy(tt.args.k, tt.args.delta)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IncrBy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("IncrBy() got = %v, want %v", got, tt.want)
+			}
+			if v, _ := c.Get(tt.args.k); !reflect.DeepEqual(v, tt.wantV) {
+				t.Errorf("Get() got = %v, want %v", v, tt.wantV)
+			}
+		})
+	}
+}
+
+func TestMemCache_DecrBy(t *testing.T) {
+	c := mockCache()
+	if got, err := c.DecrBy("int", 3); got != -2 || err != nil {
+		t.Errorf("DecrBy() = %v, %v, want %v, %v", got, err, -2, nil)
+	}
+	if got, err := c.DecrBy("null", 3); got != -3 || err != nil {
+		t.Errorf("DecrBy() = %v, %v, want %v, %v", got, err, -3, nil)
+	}
+}
+
+func TestMemCache_IncrByFloat(t *testing.T) {
+	type args struct {
+		k     string
+		delta float64
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    float64
+		wantV   interface{}
+		wantErr bool
+	}{
+		{name: "float64", args: args{k: "float64", delta: 0.5}, want: 1.6, wantV: 1.6},
+		{name: "float32", args: args{k: "float32", delta: 1}, want: float64(float32(2.1)), wantV: float32(2.1)},
+		{name: "int", args: args{k: "int", delta: 0.5}, want: 1.5, wantV: 1.5},
+		{name: "null", args: args{k: "null", delta: 0.5}, want: 0.5, wantV: 0.5},
+		{name: "string", args: args{k: "string", delta: 1}, want: 0, wantV: "a", wantErr: true},
+	}
+	c := mockCache()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.IncrByFloat(tt.args.k, tt.args.delta)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IncrByFloat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("IncrByFloat() got = %v, want %v", got, tt.want)
+			}
+			if v, _ := c.Get(tt.args.k); !reflect.DeepEqual(v, tt.wantV) {
+				t.Errorf("Get() got = %v, want %v", v, tt.wantV)
+			}
+		})
+	}
+}
+
+func TestMemCache_IncrByKeepsTTL(t *testing.T) {
+	c := mockCache()
+	c.IncrBy("ex", 1)
+	if got, ok := c.Ttl("ex"); !ok || 1*time.Second-got > 10*time.Millisecond {
+		t.Errorf("Ttl() = %v, %v, want %v, %v", got, ok, 1*time.Second, true)
+	}
+	_, err := c.IncrBy("string", 1)
+	var e *NotNumericError
+	if !errors.As(err, &e) || e.Key != "string" {
+		t.Errorf("IncrBy() error = %v, want *NotNumericError", err)
+	}
+}
+
+func TestMemCache_IncrByConcurrent(t *testing.T) {
+	const goroutines, incrs = 50, 1000
+	c := NewMemCache()
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < incrs; i++ {
+				c.IncrBy("k", 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got, _ := c.Get("k"); got != int64(goroutines*incrs) {
+		t.Errorf("Get() = %v, want %v", got, goroutines*incrs)
+	}
+}
+
+func TestMemCache_GetWithVersion(t *testing.T) {
+	c := NewMemCache()
+	if _, version, ok := c.GetWithVersion("k"); version != 0 || ok {
+		t.Errorf("GetWithVersion() = %v, %v, want %v, %v", version, ok, 0, false)
+	}
+	c.Set("k", 1)
+	v, v1, _ := c.GetWithVersion("k")
+	if v != 1 || v1 == 0 {
+		t.Errorf("GetWithVersion() = %v, %v, want %v, > 0", v, v1, 1)
+	}
+	c.Expire("k", time.Minute)
+	if _, version, _ := c.GetWithVersion("k"); version != v1 {
+		t.Errorf("GetWithVersion() after Expire() = %v, want %v", version, v1)
+	}
+	c.Set("k", 1)
+	if _, version, _ := c.GetWithVersion("k"); version <= v1 {
+		t.Errorf("GetWithVersion() after Set() = %v, want > %v", version, v1)
+	}
+}
+
+func TestMemCache_CompareAndSwap(t *testing.T) {
+	type args struct {
+		k       string
+		version func(c ICache) uint64
+		opts    []SetIOption
+	}
+	current := func(k string) func(c ICache) uint64 {
+		return func(c ICache) uint64 {
+			_, version, _ := c.GetWithVersion(k)
+			return version
+		}
+	}
+	stale := func(k string) func(c ICache) uint64 {
+		return func(c ICache) uint64 {
+			_, version, _ := c.GetWithVersion(k)
+			c.Set(k, "other")
+			return version
+		}
+	}
+	tests := []struct {
+		name  string
+		args  args
+		want  bool
+		wantV interface{}
+	}{
+		{name: "current", args: args{k: "int", version: current("int")}, want: true, wantV: 2},
+		{name: "stale", args: args{k: "int", version: stale("int")}, want: false, wantV: "other"},
+		{name: "absent", args: args{k: "null", version: current("null")}, want: true, wantV: 2},
+		{name: "absent but set", args: args{k: "int", version: func(c ICache) uint64 { return 0 }}, want: false, wantV: 1},
+		{name: "option", args: args{k: "int", version: current("int"), opts: []SetIOption{WithXx()}}, want: true, wantV: 2},
+		{name: "failed option", args: args{k: "int", version: current("int"), opts: []SetIOption{WithNx()}}, want: false, wantV: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockCache()
+			version := tt.args.version(c)
+			if got := c.CompareAndSwap(tt.args.k, version, 2, tt.args.opts...); got != tt.want {
+				t.Errorf("CompareAndSwap() = %v, want %v", got, tt.want)
+			}
+			if got, _ := c.Get(tt.args.k); got != tt.wantV {
+				t.Errorf("Get() = %v, want %v", got, tt.wantV)
+			}
+		})
+	}
+}
+
+func TestMemCache_CompareAndDelete(t *testing.T) {
+	c := mockCache()
+	_, version, _ := c.GetWithVersion("int")
+	c.Set("int", 2)
+	if got := c.CompareAndDelete("int", version); got != false {
+		t.Errorf("CompareAndDelete() stale = %v, want %v", got, false)
+	}
+	_, version, _ = c.GetWithVersion("int")
+	if got := c.CompareAndDelete("int", version); got != true {
+		t.Errorf("CompareAndDelete() = %v, want %v", got, true)
+	}
+	if got := c.CompareAndDelete("null", 0); got != false {
+		t.Errorf("CompareAndDelete() absent = %v, want %v", got, false)
+	}
+}
+
+func TestMemCache_CompareAndSwapConcurrent(t *testing.T) {
+	const goroutines, incrs = 20, 200
+	c := NewMemCache()
+	c.Set("k", 0)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < incrs; i++ {
+				for {
+					v, version, _ := c.GetWithVersion("k")
+					if c.CompareAndSwap("k", version, v.(int)+1) {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got, _ := c.Get("k"); got != goroutines*incrs {
+		t.Errorf("Get() = %v, want %v", got, goroutines*incrs)
+	}
+}
+
+func TestMemCache_Compute(t *testing.T) {
+	appendA := func(old interface{}, exists bool) (interface{}, bool) {
+		if !exists {
+			return "a", true
+		}
+		return old.(string) + "a", true
+	}
+	remove := func(old interface{}, exists bool) (interface{}, bool) {
+		return nil, false
+	}
+	type args struct {
+		k    string
+		f    func(old interface{}, exists bool) (interface{}, bool)
+		opts []SetIOption
+	}
+	tests := []struct {
+		name  string
+		args  args
+		want  interface{}
+		want1 bool
+	}{
+		{name: "present", args: args{k: "string", f: appendA}, want: "aa", want1: true},
+		{name: "absent", args: args{k: "null", f: appendA}, want: "a", want1: true},
+		{name: "expired", args: args{k: "expired", f: appendA}, want: "a", want1: true},
+		{name: "delete", args: args{k: "string", f: remove}, want: nil, want1: false},
+		{name: "delete absent", args: args{k: "null", f: remove}, want: nil, want1: false},
+		{name: "failed option", args: args{k: "string", f: appendA, opts: []SetIOption{WithNx()}}, want: "a", want1: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockCache()
+			c.Set("expired", "expired", WithEx(time.Nanosecond))
+			got, got1 := c.Compute(tt.args.k, tt.args.f, tt.args.opts...)
+			if !reflect.DeepEqual(got, tt.want) || got1 != tt.want1 {
+				t.Errorf("Compute() = %v, %v, want %v, %v", got, got1, tt.want, tt.want1)
+			}
+			if got, got1 := c.Get(tt.args.k); !reflect.DeepEqual(got, tt.want) || got1 != tt.want1 {
+				t.Errorf("Get() = %v, %v, want %v, %v", got, got1, tt.want, tt.want1)
+			}
+		})
+	}
+}
+
+func TestMemCache_ComputeIfAbsent(t *testing.T) {
+	tests := []struct {
+		name  string
+		k     string
+		keep  bool
+		want  interface{}
+		want1 bool
+	}{
+		{name: "present", k: "int", keep: true, want: 1, want1: true},
+		{name: "absent", k: "null", keep: true, want: 2, want1: true},
+		{name: "absent not kept", k: "null", keep: false, want: nil, want1: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockCache()
+			got, got1 := c.ComputeIfAbsent(tt.k, func() (interface{}, bool) { return 2, tt.keep })
+			if got != tt.want || got1 != tt.want1 {
+				t.Errorf("ComputeIfAbsent() = %v, %v, want %v, %v", got, got1, tt.want, tt.want1)
+			}
+		})
+	}
+}
+
+func TestMemCache_ComputeIfPresent(t *testing.T) {
+	tests := []struct {
+		name  string
+		k     string
+		keep  bool
+		want  interface{}
+		want1 bool
+	}{
+		{name: "present", k: "int", keep: true, want: 2, want1: true},
+		{name: "present not kept", k: "int", keep: false, want: nil, want1: false},
+		{name: "absent", k: "null", keep: true, want: nil, want1: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockCache()
+			got, got1 := c.ComputeIfPresent(tt.k, func(old interface{}) (interface{}, bool) { return old.(int) + 1, tt.keep })
+			if got != tt.want || got1 != tt.want1 {
+				t.Errorf("ComputeIfPresent() = %v, %v, want %v, %v", got, got1, tt.want, tt.want1)
+			}
+			if _, ok := c.Get(tt.k); ok != tt.want1 {
+				t.Errorf("Get() got1 = %v, want %v", ok, tt.want1)
+			}
+		})
+	}
+}
+
+// failOnDeadlock fails the test if f does not return within d.
+func failOnDeadlock(t *testing.T, d time.Duration, f func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	select {
+	case <-done:
+	case <-time.After(d):
+		t.Fatalf("deadlock: not done after %v", d)
+	}
+}
+
+func TestMemCache_ComputeDeadlock(t *testing.T) {
+	c := NewMemCache(WithShards(4))
+	failOnDeadlock(t, 5*time.Second, func() {
+		// A panicking f releases the shard lock.
+		func() {
+			defer func() { _ = recover() }()
+			c.Compute("k", func(old interface{}, exists bool) (interface{}, bool) { panic("compute") })
+		}()
+		c.Set("k", 0)
+		// Concurrent computes on keys sharing shards, mixed with other operations, all complete.
+		var wg sync.WaitGroup
+		for g := 0; g < 20; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 500; i++ {
+					k := string(rune('a' + (g+i)%8))
+					c.Compute("k", func(old interface{}, exists bool) (interface{}, bool) { return old.(int) + 1, true })
+					c.ComputeIfAbsent(k, func() (interface{}, bool) { return 0, true })
+					c.Get(k)
+					c.Del(k)
+				}
+			}(g)
+		}
+		wg.Wait()
+	})
+	if got, _ := c.Get("k"); got != 20*500 {
+		t.Errorf("Get() = %v, want %v", got, 20*500)
+	}
+}
+
+func TestMemCache_GetOrLoad(t *testing.T) {
+	type args struct {
+		k      string
+		loader LoaderFunc
+	}
+	value := func(v interface{}, ttl time.Duration, err error) LoaderFunc {
+		return func(ctx context.Context) (interface{}, time.Duration, error) {
+			return v, ttl, err
+		}
+	}
+	errLoad := errors.New("load")
+	tests := []struct {
+		name    string
+		args    args
+		want    interface{}
+		wantErr error
+		wantTtl bool
+		wantGet bool
+	}{
+		{name: "hit", args: args{k: "int", loader: value(2, 0, nil)}, want: 1, wantGet: true},
+		{name: "miss", args: args{k: "null", loader: value(2, 0, nil)}, want: 2, wantGet: true},
+		{name: "miss with ttl", args: args{k: "null", loader: value(2, time.Minute, nil)}, want: 2, wantTtl: true, wantGet: true},
+		{name: "error", args: args{k: "null", loader: value(nil, 0, errLoad)}, want: nil, wantErr: errLoad},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockCache()
+			got, err := c.GetOrLoad(context.Background(), tt.args.k, tt.args.loader)
+			if got != tt.want || err != tt.wantErr {
+				t.Errorf("GetOrLoad() = %v, %v, want %v, %v", got, err, tt.want, tt.wantErr)
+			}
+			if _, ok := c.Get(tt.args.k); ok != tt.wantGet {
+				t.Errorf("Get() got1 = %v, want %v", ok, tt.wantGet)
+			}
+			if _, ok := c.Ttl(tt.args.k); ok != tt.wantTtl {
+				t.Errorf("Ttl() got1 = %v, want %v", ok, tt.wantTtl)
+			}
+		})
+	}
+}
+
+func TestMemCache_GetOrLoadConcurrent(t *testing.T) {
+	const goroutines = 100
+	c := NewMemCache()
+	var calls int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, time.Duration, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "v", 0, nil
+	}
+	var wg sync.WaitGroup
+	results := make(chan interface{}, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, _ := c.GetOrLoad(context.Background(), "k", loader)
+			results <- v
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("loader called %v times, want %v", got, 1)
+	}
+	for v := range results {
+		if v != "v" {
+			t.Errorf("GetOrLoad() = %v, want %v", v, "v")
+		}
+	}
+}
+
+func TestMemCache_GetOrLoadCancel(t *testing.T) {
+	c := NewMemCache()
+	release := make(chan struct{})
+	canceled := make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, time.Duration, error) {
+		select {
+		case <-release:
+			return "v", 0, nil
+		case <-ctx.Done():
+			close(canceled)
+			return nil, 0, ctx.Err()
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	waited := make(chan interface{})
+	go func() {
+		v, _ := c.GetOrLoad(context.Background(), "k", loader)
+		waited <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	// The canceled caller returns at once, the load goes on for the other caller.
+	if _, err := c.GetOrLoad(ctx, "k", loader); err != context.Canceled {
+		t.Errorf("GetOrLoad() err = %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	if v := <-waited; v != "v" {
+		t.Errorf("GetOrLoad() = %v, want %v", v, "v")
+	}
+	// Once every caller gave up, the loader is canceled.
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	release = make(chan struct{})
+	if _, err := c.GetOrLoad(ctx, "other", loader); err != context.Canceled {
+		t.Errorf("GetOrLoad() err = %v, want %v", err, context.Canceled)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Errorf("loader was not canceled")
+	}
+}
+
+func TestMemCache_GetOrLoadSetDuringLoad(t *testing.T) {
+	c := NewMemCache()
+	loading, release := make(chan struct{}), make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, time.Duration, error) {
+		close(loading)
+		<-release
+		return "loaded", 0, nil
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.GetOrLoad(context.Background(), "k", loader)
+	}()
+	<-loading
+	c.Set("k", "fresh")
+	close(release)
+	<-done
+	if got, _ := c.Get("k"); got != "fresh" {
+		t.Errorf("Get() = %v, want the value set during the load %v", got, "fresh")
+	}
+}
+
+func TestMemCache_MSet(t *testing.T) {
+	tests := []struct {
+		name string
+		kvs  map[string]interface{}
+		opts []SetIOption
+		want int
+	}{
+		{name: "new", kvs: map[string]interface{}{"a": 1, "b": 2}, want: 2},
+		{name: "overwrite", kvs: map[string]interface{}{"int": 2, "c": 3}, want: 2},
+		{name: "nx", kvs: map[string]interface{}{"string": "b", "d": 4}, opts: []SetIOption{WithNx()}, want: 1},
+		{name: "empty", kvs: map[string]interface{}{}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockCache()
+			if got := c.MSet(tt.kvs, tt.opts...); got != tt.want {
+				t.Errorf("MSet() = %v, want %v", got, tt.want)
+			}
+			if got := c.MGet(keysOf(tt.kvs)...); tt.opts == nil && !reflect.DeepEqual(got, tt.kvs) {
+				t.Errorf("MGet() = %v, want %v", got, tt.kvs)
+			}
+		})
+	}
+	c := NewMemCache(WithShards(4))
+	c.MSet(map[string]interface{}{"a": 1, "b": 2}, WithEx(time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	if got := c.MGet("a", "b"); len(got) != 0 {
+		t.Errorf("MGet() = %v, want expired keys", got)
+	}
+}
+
+func TestMemCache_MSetNX(t *testing.T) {
+	tests := []struct {
+		name string
+		kvs  map[string]interface{}
+		want bool
+	}{
+		{name: "new", kvs: map[string]interface{}{"a": 1, "b": 2, "c": 3}, want: true},
+		{name: "one exists", kvs: map[string]interface{}{"a": 1, "int": 2}, want: false},
+		{name: "expired", kvs: map[string]interface{}{"a": 1, "expired": 2}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockCache(WithShards(4))
+			c.Set("expired", 1, WithEx(time.Millisecond))
+			time.Sleep(2 * time.Millisecond)
+			if got := c.MSetNX(tt.kvs); got != tt.want {
+				t.Errorf("MSetNX() = %v, want %v", got, tt.want)
+			}
+			if got := c.Exists("a"); got != tt.want {
+				t.Errorf("Exists() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemCache_MSetNXConcurrent(t *testing.T) {
+	c := NewMemCache(WithShards(4))
+	var wg sync.WaitGroup
+	var stored int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			kvs := map[string]interface{}{}
+			for j := 0; j < 16; j++ {
+				kvs[strconv.Itoa((i+j)%16)] = i
+			}
+			if c.MSetNX(kvs) {
+				atomic.AddInt32(&stored, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if stored != 1 {
+		t.Fatalf("MSetNX() succeeded %d times, want 1", stored)
+	}
+	values := map[interface{}]bool{}
+	for _, v := range c.ToMap() {
+		values[v] = true
+	}
+	if len(values) != 1 {
+		t.Errorf("ToMap() values = %v, want the values of a single MSetNX", values)
+	}
+}
+
+func TestMemCache_DelBatch(t *testing.T) {
+	var removed []string
+	c := mockCache(WithShards(4), WithRemovalListener(func(k string, v interface{}, reason RemovalReason) error {
+		removed = append(removed, k)
+		return nil
+	}))
+	if got, want := c.Del("int", "int32", "int", "null", "string"), 3; got != want {
+		t.Errorf("Del() = %v, want %v", got, want)
+	}
+	sort.Strings(removed)
+	if want := []string{"int", "int32", "string"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+}
+
+func keysOf(kvs map[string]interface{}) []string {
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func TestMemCache_Len(t *testing.T) {
+	c := mockCache(WithClearInterval(0))
+	c.Set("expired", 1, WithEx(time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	if got, want := c.Len(), 7; got != want {
+		t.Errorf("Len() = %v, want %v", got, want)
+	}
+	c.Del("int", "string")
+	if got, want := c.Len(), 5; got != want {
+		t.Errorf("Len() = %v, want %v", got, want)
+	}
+}
+
+func TestMemCache_Keys(t *testing.T) {
+	c := NewMemCache(WithShards(4), WithClearInterval(0))
+	for _, k := range []string{"user:1", "user:2", "user:10", "order:1", "user*"} {
+		c.Set(k, 1)
+	}
+	c.Set("user:3", 1, WithEx(time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	tests := []struct {
+		name    string
+		pattern string
+		want    []string
+	}{
+		{name: "all", pattern: "*", want: []string{"order:1", "user*", "user:1", "user:10", "user:2"}},
+		{name: "prefix", pattern: "user:*", want: []string{"user:1", "user:10", "user:2"}},
+		{name: "single", pattern: "user:?", want: []string{"user:1", "user:2"}},
+		{name: "class", pattern: "*:[^2]", want: []string{"order:1", "user:1"}},
+		{name: "escape", pattern: "user\\*", want: []string{"user*"}},
+		{name: "none", pattern: "item:*", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.Keys(tt.pattern)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Keys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	got := c.KeysWithPrefix("user:1")
+	sort.Strings(got)
+	if want := []string{"user:1", "user:10"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("KeysWithPrefix() = %v, want %v", got, want)
+	}
+}
+
+func TestMemCache_Scan(t *testing.T) {
+	c := NewMemCache(WithShards(8), WithClearInterval(0))
+	for i := 0; i < 100; i++ {
+		c.Set("user:"+strconv.Itoa(i), i)
+		c.Set("order:"+strconv.Itoa(i), i)
+	}
+	c.Del("user:0", "order:0")
+	c.Set("user:expired", 1, WithEx(time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	tests := []struct {
+		name  string
+		match string
+		count int
+		want  int
+	}{
+		{name: "all", match: "", count: 10, want: 198},
+		{name: "default count", match: "*", count: 0, want: 198},
+		{name: "prefix", match: "user:*", count: 7, want: 99},
+		{name: "pattern", match: "*:?", count: 1000, want: 18},
+		{name: "none", match: "item:*", count: 10, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := map[string]int{}
+			var cursor uint64
+			var calls int
+			for {
+				var keys []string
+				cursor, keys = c.Scan(cursor, tt.match, tt.count)
+				calls++
+				for _, k := range keys {
+					seen[k]++
+				}
+				if cursor == 0 {
+					break
+				}
+			}
+			if len(seen) != tt.want {
+				t.Errorf("Scan() returned %d keys, want %d", len(seen), tt.want)
+			}
+			for k, n := range seen {
+				if n != 1 {
+					t.Errorf("Scan() returned %q %d times, want once", k, n)
+				}
+			}
+			if tt.count == 7 && calls < 199/7 {
+				t.Errorf("Scan() took %d calls, want at least %d", calls, 199/7)
+			}
+		})
+	}
+	c.Flush()
+	c.Set("a", 1)
+	if cursor, keys := c.Scan(0, "", 10); cursor != 0 || !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Errorf("Scan() after Flush = %v, %v, want 0, [a]", cursor, keys)
+	}
+}
+
+func TestMemCache_ScanConcurrent(t *testing.T) {
+	c := NewMemCache(WithShards(4))
+	for i := 0; i < 1000; i++ {
+		c.Set("stable:"+strconv.Itoa(i), i)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5000; i++ {
+			k := "churn:" + strconv.Itoa(i%300)
+			if i%3 == 0 {
+				c.Del(k)
+			} else {
+				c.Set(k, i)
+			}
+		}
+	}()
+	seen := map[string]bool{}
+	var cursor uint64
+	for {
+		var keys []string
+		cursor, keys = c.Scan(cursor, "stable:*", 5)
+		for _, k := range keys {
+			seen[k] = true
+		}
+		if cursor == 0 {
+			break
+		}
+		runtime.Gosched()
+	}
+	<-done
+	if len(seen) != 1000 {
+		t.Errorf("Scan() returned %d stable keys, want 1000", len(seen))
+	}
+}
@@ -3,12 +3,32 @@ package cache
 import "time"
 
 type Config struct {
-	shards          int
-	expiredCallback ExpiredCallback
-	hash            IHash
-	clearInterval   time.Duration
+	// The fields of type interface{} depend on the type of the keys, newMemCache asserts them.
+	shards               int
+	expiredCallback      interface{}
+	removalListener      interface{}
+	callbackWorkers      int
+	callbackQueueLen     int
+	callbackOverflow     OverflowStrategy
+	callbackErrorHandler interface{}
+	hash                 interface{}
+	clearInterval        time.Duration
+	maxEntries           int
+	maxCost              int64
+	sizer                Sizer
+	policy               Policy
+	newPolicy            interface{}
+	loader               interface{}
+	refreshAhead         float64
+	negativeTTL          time.Duration
+	jitter               float64
+	jitterSeed           int64
+	store                interface{}
+	writeBehindInterval  time.Duration
+	writeBehindBatch     int
+	storeErrorHandler    interface{}
 }
 
 func NewConfig() *Config {
-	return &Config{shards: 1024, hash: newDefaultHash(), clearInterval: 1 * time.Second}
+	return &Config{shards: 1024, sizer: newDefaultSizer(), clearInterval: 1 * time.Second, jitterSeed: time.Now().UnixNano()}
 }
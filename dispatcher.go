@@ -0,0 +1,123 @@
+package cache
+
+// OverflowStrategy tells what to do with a callback when the queue of the callback workers is full
+type OverflowStrategy int
+
+const (
+	// OverflowBlock waits for room in the queue.
+	OverflowBlock OverflowStrategy = iota
+	// OverflowDrop discards the callback.
+	OverflowDrop
+	// OverflowRunInline runs the callback in the goroutine which removed the key.
+	OverflowRunInline
+)
+
+// CallbackErrorHandler Handle the error returned by an ExpiredCallback or a RemovalListener
+type CallbackErrorHandler func(k string, v interface{}, err error)
+
+// callbackTask is a removed key-value pair waiting to be passed to the callbacks.
+type callbackTask[K comparable] struct {
+	k      K
+	v      interface{}
+	reason RemovalReason
+	// expired tells whether the ExpiredCallback is called too.
+	expired bool
+}
+
+// callbackDispatcher runs the ExpiredCallback and RemovalListener of a cache,
+// either synchronously or on a bounded pool of workers.
+type callbackDispatcher[K comparable] struct {
+	expiredCallback func(k K, v interface{}) error
+	removalListener func(k K, v interface{}, reason RemovalReason) error
+	errorHandler    func(k K, v interface{}, err error)
+	overflow        OverflowStrategy
+	// tasks is nil when the callbacks are synchronous.
+	tasks  chan callbackTask[K]
+	closed chan struct{}
+}
+
+func newCallbackDispatcher[K comparable](conf *Config, closed chan struct{}) *callbackDispatcher[K] {
+	d := &callbackDispatcher[K]{
+		expiredCallback: typed[func(K, interface{}) error](conf.expiredCallback),
+		removalListener: typed[func(K, interface{}, RemovalReason) error](conf.removalListener),
+		errorHandler:    typed[func(K, interface{}, error)](conf.callbackErrorHandler),
+		overflow:        conf.callbackOverflow,
+		closed:          closed,
+	}
+	if conf.callbackWorkers > 0 && (d.expiredCallback != nil || d.removalListener != nil) {
+		d.tasks = make(chan callbackTask[K], conf.callbackQueueLen)
+		for i := 0; i < conf.callbackWorkers; i++ {
+			go d.work()
+		}
+	}
+	return d
+}
+
+// active reports whether there is any callback to run for a removal.
+func (d *callbackDispatcher[K]) active() bool {
+	return d.removalListener != nil || d.expiredCallback != nil
+}
+
+// dispatch runs the callbacks of the task, or queues it for the workers.
+func (d *callbackDispatcher[K]) dispatch(t callbackTask[K]) {
+	if d.removalListener == nil && (!t.expired || d.expiredCallback == nil) {
+		return
+	}
+	if d.tasks == nil {
+		d.run(t)
+		return
+	}
+	switch d.overflow {
+	case OverflowDrop:
+		select {
+		case d.tasks <- t:
+		default:
+		}
+	case OverflowRunInline:
+		select {
+		case d.tasks <- t:
+		default:
+			d.run(t)
+		}
+	default:
+		select {
+		case d.tasks <- t:
+		case <-d.closed:
+			d.run(t)
+		}
+	}
+}
+
+func (d *callbackDispatcher[K]) run(t callbackTask[K]) {
+	if t.expired && d.expiredCallback != nil {
+		d.handle(t, d.expiredCallback(t.k, t.v))
+	}
+	if d.removalListener != nil {
+		d.handle(t, d.removalListener(t.k, t.v, t.reason))
+	}
+}
+
+func (d *callbackDispatcher[K]) handle(t callbackTask[K], err error) {
+	if err != nil && d.errorHandler != nil {
+		d.errorHandler(t.k, t.v, err)
+	}
+}
+
+// work runs the queued callbacks until the cache is closed, then the tasks left in the queue.
+func (d *callbackDispatcher[K]) work() {
+	for {
+		select {
+		case t := <-d.tasks:
+			d.run(t)
+		case <-d.closed:
+			for {
+				select {
+				case t := <-d.tasks:
+					d.run(t)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package cache
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+// Cache is a type-safe cache of V values with K keys, built on the same shards as the ICache returned by NewMemCache.
+// Its methods behave like the ones of ICache with the same name, without type assertions:
+// a missing value is returned as the zero V.
+// The SetIOption of a Cache whose keys are not strings get a nil ICache and an empty key.
+type Cache[K comparable, V any] struct {
+	c *memCache[K]
+}
+
+// New returns a Cache of V values with K keys, configured by the same options as NewMemCache.
+// The options depending on the types of the keys and values have a generic version, e.g. WithLoaderOf,
+// WithRemovalListenerOf or WithHasher. New panics if they are given for other types of keys.
+// Example:
+// c := New[int, User](WithShards(64), WithHasher[int](hasher))
+// c.Set(1, User{Name: "demo"})
+// u, ok := c.Get(1) // u is a User
+func New[K comparable, V any](opts ...ICacheOption) *Cache[K, V] {
+	conf := NewConfig()
+	for _, opt := range opts {
+		opt(conf)
+	}
+	var zero V
+	cache := &Cache[K, V]{newMemCache[K](conf, any(zero))}
+	// Associated finalizer function with obj.
+	// When the obj is unreachable, close the obj.
+	runtime.SetFinalizer(cache, func(cache *Cache[K, V]) { cache.c.close() })
+	return cache
+}
+
+// cast returns v as a V, the zero V if v is nil.
+func cast[V any](v interface{}) V {
+	t, _ := v.(V)
+	return t
+}
+
+// castMap returns the values of m as V.
+func castMap[K comparable, V any](m map[K]interface{}) map[K]V {
+	if m == nil {
+		return nil
+	}
+	result := make(map[K]V, len(m))
+	for k, v := range m {
+		result[k] = cast[V](v)
+	}
+	return result
+}
+
+// anyMap returns the values of m as interface{}.
+func anyMap[K comparable, V any](m map[K]V) map[K]interface{} {
+	result := make(map[K]interface{}, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+// Set see ICache.Set
+func (c *Cache[K, V]) Set(k K, v V, opts ...SetIOption) bool {
+	return c.c.Set(k, v, opts...)
+}
+
+// Get see ICache.Get
+func (c *Cache[K, V]) Get(k K) (V, bool) {
+	v, ok := c.c.Get(k)
+	return cast[V](v), ok
+}
+
+// GetE see ICache.GetE
+func (c *Cache[K, V]) GetE(k K) (V, error) {
+	v, err := c.c.GetE(k)
+	return cast[V](v), err
+}
+
+// MGet see ICache.MGet
+func (c *Cache[K, V]) MGet(keys ...K) map[K]V {
+	return castMap[K, V](c.c.MGet(keys...))
+}
+
+// MGetE see ICache.MGetE
+func (c *Cache[K, V]) MGetE(keys ...K) (map[K]V, error) {
+	result, err := c.c.MGetE(keys...)
+	return castMap[K, V](result), err
+}
+
+// MSet see ICache.MSet
+func (c *Cache[K, V]) MSet(kvs map[K]V, opts ...SetIOption) int {
+	return c.c.MSet(anyMap(kvs), opts...)
+}
+
+// MSetNX see ICache.MSetNX
+func (c *Cache[K, V]) MSetNX(kvs map[K]V, opts ...SetIOption) bool {
+	return c.c.MSetNX(anyMap(kvs), opts...)
+}
+
+// GetOrLoad see ICache.GetOrLoad
+func (c *Cache[K, V]) GetOrLoad(ctx context.Context, k K, loader func(ctx context.Context) (V, time.Duration, error)) (V, error) {
+	v, err := c.c.GetOrLoad(ctx, k, func(ctx context.Context) (interface{}, time.Duration, error) {
+		v, ttl, err := loader(ctx)
+		if err != nil {
+			return nil, ttl, err
+		}
+		return v, ttl, nil
+	})
+	return cast[V](v), err
+}
+
+// GetWithStale see ICache.GetWithStale
+func (c *Cache[K, V]) GetWithStale(k K) (V, bool, bool) {
+	v, stale, ok := c.c.GetWithStale(k)
+	return cast[V](v), stale, ok
+}
+
+// GetWithVersion see ICache.GetWithVersion
+func (c *Cache[K, V]) GetWithVersion(k K) (V, uint64, bool) {
+	v, version, ok := c.c.GetWithVersion(k)
+	return cast[V](v), version, ok
+}
+
+// CompareAndSwap see ICache.CompareAndSwap
+func (c *Cache[K, V]) CompareAndSwap(k K, version uint64, v V, opts ...SetIOption) bool {
+	return c.c.CompareAndSwap(k, version, v, opts...)
+}
+
+// CompareAndDelete see ICache.CompareAndDelete
+func (c *Cache[K, V]) CompareAndDelete(k K, version uint64) bool {
+	return c.c.CompareAndDelete(k, version)
+}
+
+// GetSet see ICache.GetSet
+func (c *Cache[K, V]) GetSet(k K, v V, opts ...SetIOption) (V, bool) {
+	old, ok := c.c.GetSet(k, v, opts...)
+	return cast[V](old), ok
+}
+
+// Compute see ICache.Compute
+func (c *Cache[K, V]) Compute(k K, f func(old V, exists bool) (newV V, keep bool), opts ...SetIOption) (V, bool) {
+	v, ok := c.c.Compute(k, func(old interface{}, exists bool) (interface{}, bool) {
+		return f(cast[V](old), exists)
+	}, opts...)
+	return cast[V](v), ok
+}
+
+// ComputeIfAbsent see ICache.ComputeIfAbsent
+func (c *Cache[K, V]) ComputeIfAbsent(k K, f func() (newV V, keep bool), opts ...SetIOption) (V, bool) {
+	v, ok := c.c.ComputeIfAbsent(k, func() (interface{}, bool) {
+		return f()
+	}, opts...)
+	return cast[V](v), ok
+}
+
+// ComputeIfPresent see ICache.ComputeIfPresent
+func (c *Cache[K, V]) ComputeIfPresent(k K, f func(old V) (newV V, keep bool), opts ...SetIOption) (V, bool) {
+	v, ok := c.c.ComputeIfPresent(k, func(old interface{}) (interface{}, bool) {
+		return f(cast[V](old))
+	}, opts...)
+	return cast[V](v), ok
+}
+
+// GetDel see ICache.GetDel
+func (c *Cache[K, V]) GetDel(k K) (V, bool) {
+	v, ok := c.c.GetDel(k)
+	return cast[V](v), ok
+}
+
+// Del see ICache.Del
+func (c *Cache[K, V]) Del(keys ...K) int {
+	return c.c.Del(keys...)
+}
+
+// DelExpired see ICache.DelExpired
+func (c *Cache[K, V]) DelExpired(k K) bool {
+	return c.c.DelExpired(k)
+}
+
+// Exists see ICache.Exists
+func (c *Cache[K, V]) Exists(keys ...K) bool {
+	return c.c.Exists(keys...)
+}
+
+// Expire see ICache.Expire
+func (c *Cache[K, V]) Expire(k K, d time.Duration) bool {
+	return c.c.Expire(k, d)
+}
+
+// ExpireAt see ICache.ExpireAt
+func (c *Cache[K, V]) ExpireAt(k K, t time.Time) bool {
+	return c.c.ExpireAt(k, t)
+}
+
+// Persist see ICache.Persist
+func (c *Cache[K, V]) Persist(k K) bool {
+	return c.c.Persist(k)
+}
+
+// Touch see ICache.Touch
+func (c *Cache[K, V]) Touch(k K) bool {
+	return c.c.Touch(k)
+}
+
+// Ttl see ICache.Ttl
+func (c *Cache[K, V]) Ttl(k K) (time.Duration, bool) {
+	return c.c.Ttl(k)
+}
+
+// IncrBy see ICache.IncrBy. A missing key starts from the zero V, so V must be a number.
+func (c *Cache[K, V]) IncrBy(k K, delta int64) (int64, error) {
+	return c.c.IncrBy(k, delta)
+}
+
+// DecrBy see ICache.DecrBy
+func (c *Cache[K, V]) DecrBy(k K, delta int64) (int64, error) {
+	return c.c.DecrBy(k, delta)
+}
+
+// IncrByFloat see ICache.IncrByFloat. Integers become a float64, so V should be a float.
+func (c *Cache[K, V]) IncrByFloat(k K, delta float64) (float64, error) {
+	return c.c.IncrByFloat(k, delta)
+}
+
+// ToMap see ICache.ToMap
+func (c *Cache[K, V]) ToMap() map[K]V {
+	return castMap[K, V](c.c.ToMap())
+}
+
+// Len see ICache.Len
+func (c *Cache[K, V]) Len() int {
+	return c.c.Len()
+}
+
+// Keys see ICache.Keys, only keys of type string can match a pattern.
+func (c *Cache[K, V]) Keys(pattern string) []K {
+	return c.c.Keys(pattern)
+}
+
+// KeysWithPrefix see ICache.KeysWithPrefix, only keys of type string can match a prefix.
+func (c *Cache[K, V]) KeysWithPrefix(prefix string) []K {
+	return c.c.KeysWithPrefix(prefix)
+}
+
+// Scan see ICache.Scan, only keys of type string can match a pattern other than "".
+func (c *Cache[K, V]) Scan(cursor uint64, match string, count int) (uint64, []K) {
+	return c.c.Scan(cursor, match, count)
+}
+
+// Cost see ICache.Cost
+func (c *Cache[K, V]) Cost() int64 {
+	return c.c.Cost()
+}
+
+// Flush see ICache.Flush
+func (c *Cache[K, V]) Flush() {
+	c.c.Flush()
+}
+
+// Close see ICache.Close
+func (c *Cache[K, V]) Close() error {
+	return c.c.Close()
+}
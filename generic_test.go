@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type user struct {
+	Name string
+	Age  int
+}
+
+// userLoader loads the users of values, it is a BulkLoaderOf[int, user].
+type userLoader struct {
+	values map[int]user
+	calls  int32
+}
+
+func (l *userLoader) Load(ctx context.Context, k int) (user, time.Duration, error) {
+	atomic.AddInt32(&l.calls, 1)
+	u, ok := l.values[k]
+	if !ok {
+		return user{}, 0, ErrNotFound
+	}
+	return u, 0, nil
+}
+
+func (l *userLoader) LoadAll(ctx context.Context, keys []int) (map[int]user, time.Duration, error) {
+	atomic.AddInt32(&l.calls, 1)
+	result := make(map[int]user)
+	for _, k := range keys {
+		if u, ok := l.values[k]; ok {
+			result[k] = u
+		}
+	}
+	return result, 0, nil
+}
+
+// countingHasher counts the keys it hashes.
+type countingHasher struct {
+	calls int32
+}
+
+func (h *countingHasher) Sum64(k int) uint64 {
+	atomic.AddInt32(&h.calls, 1)
+	return uint64(k)
+}
+
+func TestCache_Get(t *testing.T) {
+	c := New[int, user](WithShards(4))
+	c.Set(1, user{Name: "a", Age: 1})
+	c.Set(2, user{Name: "b", Age: 2}, WithEx(time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	tests := []struct {
+		name  string
+		k     int
+		want  user
+		want1 bool
+	}{
+		{name: "exist", k: 1, want: user{Name: "a", Age: 1}, want1: true},
+		{name: "expired", k: 2, want: user{}, want1: false},
+		{name: "not exist", k: 3, want: user{}, want1: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, got1 := c.Get(tt.k)
+			if got != tt.want || got1 != tt.want1 {
+				t.Errorf("Get() = %v, %v, want %v, %v", got, got1, tt.want, tt.want1)
+			}
+		})
+	}
+	if got, want := c.ToMap(), map[int]user{1: {Name: "a", Age: 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ToMap() = %v, want %v", got, want)
+	}
+	if got, _ := c.Compute(1, func(old user, exists bool) (user, bool) {
+		old.Age++
+		return old, exists
+	}); got.Age != 2 {
+		t.Errorf("Compute() = %v, want Age 2", got)
+	}
+}
+
+func TestCache_IncrBy(t *testing.T) {
+	c := New[string, int32]()
+	if got, err := c.IncrBy("a", 2); got != 2 || err != nil {
+		t.Fatalf("IncrBy() = %v, %v, want 2, nil", got, err)
+	}
+	if got, ok := c.Get("a"); got != 2 || !ok {
+		t.Errorf("Get() = %v, %v, want 2, true", got, ok)
+	}
+}
+
+func TestWithHasher(t *testing.T) {
+	h := &countingHasher{}
+	c := New[int, string](WithShards(4), WithHasher[int](h))
+	c.Set(1, "a")
+	c.Set(6, "b")
+	if got := atomic.LoadInt32(&h.calls); got != 2 {
+		t.Errorf("Sum64 calls = %v, want 2", got)
+	}
+	if _, ok := c.c.shards[1].hashmap[1]; !ok {
+		t.Error("key 1 is not in shard 1")
+	}
+	if _, ok := c.c.shards[2].hashmap[6]; !ok {
+		t.Error("key 6 is not in shard 2")
+	}
+}
+
+func TestWithLoaderOf(t *testing.T) {
+	l := &userLoader{values: map[int]user{1: {Name: "a"}, 2: {Name: "b"}}}
+	c := New[int, user](WithLoaderOf[int, user](l))
+	if got, err := c.GetE(1); got.Name != "a" || err != nil {
+		t.Errorf("GetE(1) = %v, %v, want a, nil", got, err)
+	}
+	if got, err := c.GetE(3); err != ErrNotFound {
+		t.Errorf("GetE(3) = %v, %v, want ErrNotFound", got, err)
+	}
+	if got, want := c.MGet(1, 2, 3), map[int]user{1: {Name: "a"}, 2: {Name: "b"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("MGet() = %v, want %v", got, want)
+	}
+	if got := atomic.LoadInt32(&l.calls); got != 3 {
+		t.Errorf("loader calls = %v, want 3", got)
+	}
+}
+
+func TestWithRemovalListenerOf(t *testing.T) {
+	var got []user
+	c := New[int, user](WithRemovalListenerOf(func(k int, v user, reason RemovalReason) error {
+		got = append(got, v)
+		return nil
+	}))
+	c.Set(1, user{Name: "a"})
+	c.Set(1, user{Name: "b"})
+	c.Del(1)
+	if want := []user{{Name: "a"}, {Name: "b"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("removals = %v, want %v", got, want)
+	}
+}
+
+func TestNew_KeyTypeMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("New() did not panic")
+		}
+	}()
+	New[int, user](WithLoader(&mapLoader{}))
+}
+
+func TestCache_Scan(t *testing.T) {
+	c := New[int, user](WithShards(4))
+	for i := 0; i < 50; i++ {
+		c.Set(i, user{Age: i})
+	}
+	var got []int
+	var cursor uint64
+	for {
+		var keys []int
+		cursor, keys = c.Scan(cursor, "", 8)
+		got = append(got, keys...)
+		if cursor == 0 {
+			break
+		}
+	}
+	if len(got) != 50 || c.Len() != 50 {
+		t.Errorf("Scan() returned %d keys, Len() = %d, want 50", len(got), c.Len())
+	}
+	if _, keys := c.Scan(0, "1*", 100); len(keys) != 0 {
+		t.Errorf("Scan() = %v, want no int key to match a pattern", keys)
+	}
+}
@@ -1,12 +1,22 @@
 package cache
 
-// IHash is responsible for generating unsigned, 64-bit hash of provided string. IHash should minimize collisions
-// (generating same hash for different strings) and while performance is also important fast functions are preferable (i.e.
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"reflect"
+	"unsafe"
+)
+
+// Hasher is responsible for generating unsigned, 64-bit hash of provided key. Hasher should minimize collisions
+// (generating same hash for different keys) and while performance is also important fast functions are preferable (i.e.
 // you can use FarmHash family).
-type IHash interface {
-	Sum64(string) uint64
+type Hasher[K comparable] interface {
+	Sum64(K) uint64
 }
 
+// IHash is the Hasher of the string keys of an ICache.
+type IHash = Hasher[string]
+
 // newDefaultHash returns a new 64-bit FNV-1a IHash which makes no memory allocations.
 // Its Sum64 method will lay the value out in big-endian byte order.
 // See https://en.wikipedia.org/wiki/Fowler–Noll–Vo_hash_function
@@ -14,6 +24,123 @@ func newDefaultHash() IHash {
 	return fnv64a{}
 }
 
+// newDefaultHasher returns the Hasher used when none is given, none of them makes memory allocations:
+// FNV-1a for strings, integer mixing for integers, a hash of the memory of the key for [N]byte
+// and for the structs and arrays made only of integers and booleans. Other keys use maphash.Comparable with a random seed.
+func newDefaultHasher[K comparable]() Hasher[K] {
+	if h, ok := any(newDefaultHash()).(Hasher[K]); ok {
+		return h
+	}
+	t := reflect.TypeFor[K]()
+	switch {
+	case t.Kind() == reflect.String:
+		return stringHasher[K]{}
+	case isInteger(t.Kind()):
+		return intHasher[K]{}
+	case isPlainMemory(t):
+		return memHasher[K]{}
+	}
+	return comparableHasher[K]{seed: maphash.MakeSeed()}
+}
+
+// isInteger reports whether k is the kind of an integer type.
+func isInteger(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// isPlainMemory reports whether two values of t are equal if and only if their memory is:
+// t is made of integers and booleans, without padding nor blank fields.
+func isPlainMemory(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool:
+		return true
+	case reflect.Array:
+		return isPlainMemory(t.Elem())
+	case reflect.Struct:
+		var size uintptr
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Name == "_" || !isPlainMemory(f.Type) {
+				return false
+			}
+			size += f.Type.Size()
+		}
+		return size == t.Size()
+	}
+	return isInteger(t.Kind())
+}
+
+// stringHasher hashes the keys of a string type other than string with FNV-1a.
+type stringHasher[K comparable] struct{}
+
+func (stringHasher[K]) Sum64(key K) uint64 {
+	return fnv64a{}.Sum64(*(*string)(unsafe.Pointer(&key)))
+}
+
+// intHasher hashes the keys of an integer type by mixing their bits.
+type intHasher[K comparable] struct{}
+
+func (intHasher[K]) Sum64(key K) uint64 {
+	p := unsafe.Pointer(&key)
+	switch unsafe.Sizeof(key) {
+	case 8:
+		return mix64(*(*uint64)(p))
+	case 4:
+		return mix64(uint64(*(*uint32)(p)))
+	case 2:
+		return mix64(uint64(*(*uint16)(p)))
+	}
+	return mix64(uint64(*(*uint8)(p)))
+}
+
+// memHasher hashes the memory of the keys, see isPlainMemory.
+type memHasher[K comparable] struct{}
+
+func (memHasher[K]) Sum64(key K) uint64 {
+	return sumBytes(unsafe.Slice((*byte)(unsafe.Pointer(&key)), unsafe.Sizeof(key)))
+}
+
+// sumBytes hashes b eight bytes at a time.
+func sumBytes(b []byte) uint64 {
+	hash := offset64 ^ uint64(len(b))
+	for ; len(b) >= 8; b = b[8:] {
+		hash = mix64(hash ^ binary.LittleEndian.Uint64(b))
+	}
+	if len(b) > 0 {
+		var tail uint64
+		for i, c := range b {
+			tail |= uint64(c) << (8 * i)
+		}
+		hash = mix64(hash ^ tail)
+	}
+	return hash
+}
+
+// mix64 is the finalizer of MurmurHash3, every bit of x affects every bit of the result.
+// See https://github.com/aappleby/smhasher/wiki/MurmurHash3
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// comparableHasher hashes any comparable key with maphash.Comparable.
+type comparableHasher[K comparable] struct {
+	seed maphash.Seed
+}
+
+func (h comparableHasher[K]) Sum64(key K) uint64 {
+	return maphash.Comparable(h.seed, key)
+}
+
 type fnv64a struct{}
 
 const (
@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+)
+
+type userID int32
+
+type point struct {
+	X, Y int32
+	Tag  [3]byte
+	Ok   bool
+}
+
+type padded struct {
+	A int8
+	B int64
+}
+
+type userName string
+
+type label struct {
+	Name string
+}
+
+func TestNewDefaultHasher(t *testing.T) {
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{name: "string", got: newDefaultHasher[string](), want: fnv64a{}},
+		{name: "string type", got: newDefaultHasher[userName](), want: stringHasher[userName]{}},
+		{name: "uint64", got: newDefaultHasher[uint64](), want: intHasher[uint64]{}},
+		{name: "integer type", got: newDefaultHasher[userID](), want: intHasher[userID]{}},
+		{name: "byte array", got: newDefaultHasher[[16]byte](), want: memHasher[[16]byte]{}},
+		{name: "struct", got: newDefaultHasher[point](), want: memHasher[point]{}},
+		{name: "padded struct", got: newDefaultHasher[padded](), want: comparableHasher[padded]{}},
+		{name: "float", got: newDefaultHasher[float64](), want: comparableHasher[float64]{}},
+		{name: "struct with string", got: newDefaultHasher[label](), want: comparableHasher[label]{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, want := reflect.TypeOf(tt.got), reflect.TypeOf(tt.want); got != want {
+				t.Errorf("newDefaultHasher() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestHasher_Sum64(t *testing.T) {
+	ints := newDefaultHasher[int]()
+	if ints.Sum64(1) == ints.Sum64(2) || ints.Sum64(-1) != ints.Sum64(-1) {
+		t.Error("intHasher does not tell keys apart")
+	}
+	if got, want := newDefaultHasher[userName]().Sum64("demo"), newDefaultHash().Sum64("demo"); got != want {
+		t.Errorf("stringHasher.Sum64() = %v, want %v", got, want)
+	}
+	ids := newDefaultHasher[userID]()
+	if ids.Sum64(-1) == ids.Sum64(1<<31-1) {
+		t.Error("intHasher does not tell negative keys apart")
+	}
+	points := newDefaultHasher[point]()
+	a, b := point{X: 1, Y: 2, Tag: [3]byte{'a'}}, point{X: 1, Y: 2, Tag: [3]byte{'b'}}
+	if points.Sum64(a) != points.Sum64(a) || points.Sum64(a) == points.Sum64(b) {
+		t.Error("memHasher does not tell keys apart")
+	}
+	arrays := newDefaultHasher[[3]byte]()
+	if arrays.Sum64([3]byte{1}) == arrays.Sum64([3]byte{0, 0, 1}) {
+		t.Error("memHasher does not tell the tail bytes apart")
+	}
+}
+
+func TestHasher_Shards(t *testing.T) {
+	const shards = 64
+	h := newDefaultHasher[uint64]()
+	counts := make([]int, shards)
+	for i := uint64(0); i < shards*100; i++ {
+		counts[h.Sum64(i*shards)&(shards-1)]++
+	}
+	for i, n := range counts {
+		if n < 50 || n > 150 {
+			t.Errorf("shard %d holds %d keys, want about 100", i, n)
+		}
+	}
+}
+
+func TestHasher_Allocs(t *testing.T) {
+	ints, arrays, points := newDefaultHasher[uint64](), newDefaultHasher[[32]byte](), newDefaultHasher[point]()
+	var sink uint64
+	allocs := testing.AllocsPerRun(100, func() {
+		sink += ints.Sum64(42)
+		sink += arrays.Sum64([32]byte{1, 2, 3})
+		sink += points.Sum64(point{X: 1})
+	})
+	if allocs != 0 {
+		t.Errorf("Sum64 allocates %v times, want 0", allocs)
+	}
+}
+
+func BenchmarkHasher_Uint64(b *testing.B) {
+	h := newDefaultHasher[uint64]()
+	for i := 0; i < b.N; i++ {
+		h.Sum64(uint64(i))
+	}
+}
+
+func BenchmarkHasher_Struct(b *testing.B) {
+	h := newDefaultHasher[point]()
+	for i := 0; i < b.N; i++ {
+		h.Sum64(point{X: int32(i)})
+	}
+}
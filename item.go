@@ -1,29 +1,143 @@
 package cache
 
-import "time"
+import (
+	"sync/atomic"
+	"time"
+)
 
 type IItem interface {
 	Expired() bool
+	Stale() bool
 	CanExpire() bool
 	SetExpireAt(t time.Time)
+	SetCost(cost int64)
 }
 
 type Item struct {
 	v      interface{}
 	expire time.Time
+	cost   int64
+	// version increases every time a value is stored, see CompareAndSwap.
+	version uint64
+	// extra holds the fields of the features most items do not use, nil if the item uses none of them.
+	// It is shared by the copies of the item, so it is read with ext and replaced by extend before being modified.
+	extra *itemExtra
+	// slot is the position of the key in the scan order of its shard, see Scan.
+	slot int32
+	// tombstone tells that the item remembers a key which the Loader did not find, see WithNegativeTTL.
+	tombstone bool
+}
+
+// itemExtra is the part of an Item only used by stale serving, sliding expiration and refresh ahead,
+// kept apart so that the items stored by value in the shards stay small.
+type itemExtra struct {
+	// soft is the deadline after which the value is stale, zero if it never goes stale, see WithSoftEx.
+	soft time.Time
+	// staleFor is how long the value is served stale after soft, see WithStaleFor.
+	staleFor time.Duration
+	// sliding is the idle duration after which the item expires, see WithSlidingEx.
+	// accessed is the time of the last access in unix nanoseconds, updated atomically by the reads.
+	sliding  time.Duration
+	accessed int64
+	// refresh is the time after which a read reloads the item ahead of its expiration, see WithRefreshAhead.
+	refresh time.Time
+}
+
+// noExtra is the itemExtra of the items which have none, it is never modified.
+var noExtra = &itemExtra{}
+
+// setting is the IItem passed to the SetIOption of a write: the item to store,
+// along with the state which only matters while the options are evaluated, kept out of the stored items.
+type setting struct {
+	Item
+	// prev is the item stored at the key if found, see exists.
+	prev  Item
+	found bool
+	// jitter is the fraction given by WithJitter, nil for the default of the cache.
+	jitter *float64
+}
+
+//ext returns the extra fields of the item, for reading only.
+func (i *Item) ext() *itemExtra {
+	if i.extra == nil {
+		return noExtra
+	}
+	return i.extra
+}
+
+//extend replaces the extra fields of the item with a copy it owns, and returns it for modification,
+//so that the other copies of the item are left untouched.
+func (i *Item) extend() *itemExtra {
+	e := &itemExtra{}
+	if x := i.extra; x != nil {
+		*e = itemExtra{soft: x.soft, staleFor: x.staleFor, sliding: x.sliding, accessed: atomic.LoadInt64(&x.accessed), refresh: x.refresh}
+	}
+	i.extra = e
+	return e
+}
+
+//exists reports whether the key holds a live item before the write, which is then prev.
+//It is evaluated on demand, so that the writes whose options do not need it skip reading the clock.
+func (s *setting) exists() bool {
+	return s.found && s.prev.live()
 }
 
 func (i *Item) Expired() bool {
 	if !i.CanExpire() {
 		return false
 	}
-	return time.Now().After(i.expire)
+	return time.Now().After(i.deadline())
+}
+
+//deadline returns the expire time, pushed back by the last access when the expiration is sliding.
+func (i *Item) deadline() time.Time {
+	if e := i.ext(); e.sliding > 0 {
+		return time.Unix(0, atomic.LoadInt64(&e.accessed)).Add(e.sliding)
+	}
+	return i.expire
+}
+
+//touch restarts the sliding expiration, if any. It only needs the read lock of the shard.
+func (i *Item) touch() {
+	if e := i.ext(); e.sliding > 0 {
+		atomic.StoreInt64(&e.accessed, time.Now().UnixNano())
+	}
+}
+
+//Stale reports whether the item passed its soft expire time, but not its expire time yet.
+func (i *Item) Stale() bool {
+	soft := i.ext().soft
+	return !soft.IsZero() && time.Now().After(soft) && !i.Expired()
+}
+
+//live reports whether the item holds a value: it is neither expired nor a tombstone.
+func (i *Item) live() bool {
+	return !i.tombstone && !i.Expired()
 }
 
 func (i *Item) CanExpire() bool {
 	return !i.expire.IsZero()
 }
 
+//SetExpireAt set the expire time, or the soft expire time when the item is served stale for a while after it.
+//It replaces a sliding expiration.
 func (i *Item) SetExpireAt(t time.Time) {
+	e := i.ext()
+	if e.sliding > 0 || (e.staleFor > 0 && !t.IsZero()) {
+		e = i.extend()
+		e.sliding, e.accessed = 0, 0
+	}
+	if e.staleFor > 0 && !t.IsZero() {
+		e.soft, i.expire = t, t.Add(e.staleFor)
+		return
+	}
+	//Without WithStaleFor, a soft expire time keeps the key until it, whatever the order of the options.
+	if !e.soft.IsZero() && t.Before(e.soft) && !t.IsZero() {
+		t = e.soft
+	}
 	i.expire = t
 }
+
+func (i *Item) SetCost(cost int64) {
+	i.cost = cost
+}
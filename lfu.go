@@ -0,0 +1,88 @@
+package cache
+
+import "container/list"
+
+// lfuBucket holds the keys used freq times, the most recently used key at the front.
+type lfuBucket struct {
+	freq  int
+	items *list.List
+}
+
+// lfuEntry is a tracked key and the element of its bucket in lfuPolicy.buckets.
+type lfuEntry[K comparable] struct {
+	key    K
+	bucket *list.Element
+}
+
+// lfuPolicy keeps buckets of keys sorted by use count, so that every operation is constant time.
+// See http://dhruvbird.com/lfu.pdf
+type lfuPolicy[K comparable] struct {
+	// buckets is sorted by increasing frequency, empty buckets are removed.
+	buckets *list.List
+	elems   map[K]*list.Element
+}
+
+// NewLFUPolicy returns an EvictionPolicy evicting the least frequently used key,
+// the least recently used one when several keys have the same count.
+func NewLFUPolicy(capacity int) EvictionPolicy {
+	return newLFUPolicy[string](capacity)
+}
+
+func newLFUPolicy[K comparable](capacity int) *lfuPolicy[K] {
+	return &lfuPolicy[K]{buckets: list.New(), elems: make(map[K]*list.Element, capacity)}
+}
+
+func (p *lfuPolicy[K]) OnAccess(k K) {
+	e, ok := p.elems[k]
+	if !ok {
+		return
+	}
+	entry := e.Value.(*lfuEntry[K])
+	current := entry.bucket
+	bucket := current.Value.(*lfuBucket)
+	next := current.Next()
+	if next == nil || next.Value.(*lfuBucket).freq != bucket.freq+1 {
+		next = p.buckets.InsertAfter(&lfuBucket{freq: bucket.freq + 1, items: list.New()}, current)
+	}
+	bucket.items.Remove(e)
+	if bucket.items.Len() == 0 {
+		p.buckets.Remove(current)
+	}
+	entry.bucket = next
+	p.elems[k] = next.Value.(*lfuBucket).items.PushFront(entry)
+}
+
+func (p *lfuPolicy[K]) OnInsert(k K) {
+	if _, ok := p.elems[k]; ok {
+		p.OnAccess(k)
+		return
+	}
+	first := p.buckets.Front()
+	if first == nil || first.Value.(*lfuBucket).freq != 1 {
+		first = p.buckets.PushFront(&lfuBucket{freq: 1, items: list.New()})
+	}
+	p.elems[k] = first.Value.(*lfuBucket).items.PushFront(&lfuEntry[K]{key: k, bucket: first})
+}
+
+func (p *lfuPolicy[K]) OnDelete(k K) {
+	e, ok := p.elems[k]
+	if !ok {
+		return
+	}
+	bucket := e.Value.(*lfuEntry[K]).bucket
+	items := bucket.Value.(*lfuBucket).items
+	items.Remove(e)
+	if items.Len() == 0 {
+		p.buckets.Remove(bucket)
+	}
+	delete(p.elems, k)
+}
+
+func (p *lfuPolicy[K]) Victim() (K, bool) {
+	first := p.buckets.Front()
+	if first == nil {
+		var zero K
+		return zero, false
+	}
+	return first.Value.(*lfuBucket).items.Back().Value.(*lfuEntry[K]).key, true
+}
@@ -0,0 +1,202 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by GetE when a key does not exist and cannot be loaded.
+// A Loader returns it when the key does not exist in the underlying data source either,
+// the miss is then remembered for the time given by WithNegativeTTL.
+var ErrNotFound = errors.New("cache: key not found")
+
+// LoaderOf loads the missing keys of a read-through cache, see WithLoader.
+type LoaderOf[K comparable, V any] interface {
+	// Load the value of a missing key, and the time to live it is cached with, 0 for no expiration.
+	// Returns ErrNotFound if the key does not exist.
+	Load(ctx context.Context, k K) (V, time.Duration, error)
+}
+
+// Loader is the LoaderOf an ICache.
+type Loader = LoaderOf[string, interface{}]
+
+// BulkLoaderOf is a LoaderOf which can also load many missing keys at once, e.g. with a single query.
+// MGet and MGetE load all their missing keys with one call of LoadAll.
+type BulkLoaderOf[K comparable, V any] interface {
+	LoaderOf[K, V]
+	// LoadAll the values of missing keys, and the time to live they are cached with, 0 for no expiration.
+	// Keys missing from the returned map do not exist.
+	LoadAll(ctx context.Context, keys []K) (map[K]V, time.Duration, error)
+}
+
+// BulkLoader is the BulkLoaderOf an ICache.
+type BulkLoader = BulkLoaderOf[string, interface{}]
+
+// anyLoader adapts a LoaderOf the values of a Cache to the interface{} values held by its shards.
+type anyLoader[K comparable, V any] struct {
+	loader LoaderOf[K, V]
+}
+
+func (l anyLoader[K, V]) Load(ctx context.Context, k K) (interface{}, time.Duration, error) {
+	v, ttl, err := l.loader.Load(ctx, k)
+	if err != nil {
+		return nil, ttl, err
+	}
+	return v, ttl, nil
+}
+
+// anyBulkLoader adapts a BulkLoaderOf the values of a Cache to the interface{} values held by its shards.
+type anyBulkLoader[K comparable, V any] struct {
+	anyLoader[K, V]
+	bulk BulkLoaderOf[K, V]
+}
+
+func (l anyBulkLoader[K, V]) LoadAll(ctx context.Context, keys []K) (map[K]interface{}, time.Duration, error) {
+	vs, ttl, err := l.bulk.LoadAll(ctx, keys)
+	if err != nil {
+		return nil, ttl, err
+	}
+	result := make(map[K]interface{}, len(vs))
+	for k, v := range vs {
+		result[k] = v
+	}
+	return result, ttl, nil
+}
+
+// toAnyLoader returns loader adapted to interface{} values, keeping it a BulkLoaderOf if it is one.
+func toAnyLoader[K comparable, V any](loader LoaderOf[K, V]) LoaderOf[K, interface{}] {
+	if loader == nil {
+		return nil
+	}
+	if l, ok := any(loader).(LoaderOf[K, interface{}]); ok {
+		return l
+	}
+	if bulk, ok := loader.(BulkLoaderOf[K, V]); ok {
+		return anyBulkLoader[K, V]{anyLoader: anyLoader[K, V]{loader}, bulk: bulk}
+	}
+	return anyLoader[K, V]{loader}
+}
+
+// load loads k with loader, deduplicating concurrent loads of k, and stores the result unless k was written in the meantime.
+func (c *memCache[K]) load(ctx context.Context, k K, loader LoaderFunc) (interface{}, error) {
+	return c.loads.do(ctx, k, func(ctx context.Context) (interface{}, error) {
+		v, ttl, err := loader(ctx)
+		if errors.Is(err, ErrNotFound) {
+			c.storeNotFound(k)
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.store(k, v, ttl)
+		return v, nil
+	})
+}
+
+// refresh reloads the item of k in the background if it is stale, or was read after the refresh time set by WithRefreshAhead.
+// The reloaded value is served stale as long as the item was, and dropped if k was written in the meantime.
+func (c *memCache[K]) refresh(k K, item Item) {
+	e := item.ext()
+	due := !e.refresh.IsZero() && !time.Now().Before(e.refresh)
+	if c.loader == nil || !(due || item.Stale()) {
+		return
+	}
+	c.reload(k, item.version, e.staleFor)
+}
+
+// reload loads k in the background, and stores the value unless the version of k changed.
+// It is apart from refresh so that the reads which do not refresh allocate nothing.
+func (c *memCache[K]) reload(k K, version uint64, staleFor time.Duration) {
+	loader := c.loader
+	c.loads.start(k, func(ctx context.Context) (interface{}, error) {
+		v, ttl, err := loader.Load(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		c.compareAndSwap(k, version, v, exOptions(ttl, staleFor), false)
+		return v, nil
+	})
+}
+
+// loadAll loads the missing keys with the configured loader, and adds the ones which exist to result.
+func (c *memCache[K]) loadAll(ctx context.Context, keys []K, result map[K]interface{}) error {
+	if bulk, ok := c.loader.(BulkLoaderOf[K, interface{}]); ok {
+		vs, ttl, err := bulk.LoadAll(ctx, keys)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if v, ok := vs[k]; ok {
+				c.store(k, v, ttl)
+				result[k] = v
+			} else {
+				c.storeNotFound(k)
+			}
+		}
+		return nil
+	}
+	for _, k := range keys {
+		v, err := c.readThrough(ctx, k)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		result[k] = v
+	}
+	return nil
+}
+
+// readThrough loads k with the configured loader.
+func (c *memCache[K]) readThrough(ctx context.Context, k K) (interface{}, error) {
+	loader := c.loader
+	return c.load(ctx, k, func(ctx context.Context) (interface{}, time.Duration, error) {
+		return loader.Load(ctx, k)
+	})
+}
+
+// store sets a loaded value with its time to live, 0 for no expiration, only if k is still missing:
+// a value set while it was loading is newer than the loaded one.
+// The value comes from the data source, so it is not written to the Store.
+func (c *memCache[K]) store(k K, v interface{}, ttl time.Duration) {
+	c.compareAndSwap(k, 0, v, exOptions(ttl, 0), false)
+}
+
+// storeNotFound stores a tombstone remembering that k was not found by the loader, if WithNegativeTTL is given.
+// Reads treat it as a key which does not exist, without calling the loader again until it expires.
+// Like a loaded value, it is only stored if k is still missing, so that it never hides a value set during the load.
+func (c *memCache[K]) storeNotFound(k K) {
+	if c.config.negativeTTL <= 0 {
+		return
+	}
+	item := Item{tombstone: true}
+	shard := c.getShard(k)
+	shard.compareAndSwap(c.self, k, 0, &item, []SetIOption{WithEx(c.config.negativeTTL)}, false)
+}
+
+// exOptions returns the options setting a time to live, 0 for no expiration, followed by staleFor of stale serving.
+func exOptions(ttl, staleFor time.Duration) []SetIOption {
+	if ttl <= 0 {
+		return nil
+	}
+	if staleFor > 0 {
+		return []SetIOption{WithSoftEx(ttl), WithStaleFor(staleFor)}
+	}
+	return []SetIOption{WithEx(ttl)}
+}
+
+// dedup removes the repeated keys, keeping the first occurrence of each.
+func dedup[K comparable](keys []K) []K {
+	seen := make(map[K]struct{}, len(keys))
+	n := 0
+	for _, k := range keys {
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		keys[n] = k
+		n++
+	}
+	return keys[:n]
+}
@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mapLoader loads the keys of values, and fails with err when it is set.
+type mapLoader struct {
+	values map[string]interface{}
+	ttl    time.Duration
+	err    error
+	calls  int32
+}
+
+func (l *mapLoader) Load(ctx context.Context, k string) (interface{}, time.Duration, error) {
+	atomic.AddInt32(&l.calls, 1)
+	if l.err != nil {
+		return nil, 0, l.err
+	}
+	v, ok := l.values[k]
+	if !ok {
+		return nil, 0, ErrNotFound
+	}
+	return v, l.ttl, nil
+}
+
+// loaderFunc adapts a function to a Loader.
+type loaderFunc func(ctx context.Context, k string) (interface{}, time.Duration, error)
+
+func (f loaderFunc) Load(ctx context.Context, k string) (interface{}, time.Duration, error) {
+	return f(ctx, k)
+}
+
+// mapBulkLoader is a mapLoader recording the keys passed to LoadAll.
+type mapBulkLoader struct {
+	mapLoader
+	lock sync.Mutex
+	keys [][]string
+}
+
+func (l *mapBulkLoader) LoadAll(ctx context.Context, keys []string) (map[string]interface{}, time.Duration, error) {
+	l.lock.Lock()
+	l.keys = append(l.keys, append([]string(nil), keys...))
+	l.lock.Unlock()
+	if l.err != nil {
+		return nil, 0, l.err
+	}
+	result := make(map[string]interface{})
+	for _, k := range keys {
+		if v, ok := l.values[k]; ok {
+			result[k] = v
+		}
+	}
+	return result, l.ttl, nil
+}
+
+func TestMemCache_GetE(t *testing.T) {
+	errLoad := errors.New("load")
+	tests := []struct {
+		name    string
+		loader  Loader
+		k       string
+		want    interface{}
+		wantErr error
+		wantGet bool
+	}{
+		{name: "hit", k: "int", want: 1, wantGet: true},
+		{name: "miss", k: "null", want: nil, wantErr: ErrNotFound},
+		{name: "load", loader: &mapLoader{values: map[string]interface{}{"null": 2}}, k: "null", want: 2, wantGet: true},
+		{name: "load not found", loader: &mapLoader{}, k: "null", want: nil, wantErr: ErrNotFound},
+		{name: "load error", loader: &mapLoader{err: errLoad}, k: "null", want: nil, wantErr: errLoad},
+		{name: "hit with loader", loader: &mapLoader{err: errLoad}, k: "int", want: 1, wantGet: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c ICache
+			if tt.loader != nil {
+				c = mockCache(WithLoader(tt.loader))
+			} else {
+				c = mockCache()
+			}
+			got, err := c.GetE(tt.k)
+			if got != tt.want || err != tt.wantErr {
+				t.Errorf("GetE() = %v, %v, want %v, %v", got, err, tt.want, tt.wantErr)
+			}
+			got, ok := c.Get(tt.k)
+			if got != tt.want || ok != tt.wantGet {
+				t.Errorf("Get() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantGet)
+			}
+		})
+	}
+}
+
+func TestMemCache_MGet(t *testing.T) {
+	errLoad := errors.New("load")
+	values := map[string]interface{}{"a": "A", "b": "B"}
+	tests := []struct {
+		name     string
+		loader   Loader
+		keys     []string
+		want     map[string]interface{}
+		wantErr  error
+		wantBulk [][]string
+	}{
+		{name: "no loader", keys: []string{"int", "a", "string"}, want: map[string]interface{}{"int": 1, "string": "a"}},
+		{name: "load", loader: &mapLoader{values: values}, keys: []string{"int", "a", "c"},
+			want: map[string]interface{}{"int": 1, "a": "A"}},
+		{name: "load error", loader: &mapLoader{err: errLoad}, keys: []string{"int", "a"},
+			want: map[string]interface{}{"int": 1}, wantErr: errLoad},
+		{name: "bulk load", loader: &mapBulkLoader{mapLoader: mapLoader{values: values}}, keys: []string{"a", "int", "b", "c", "a"},
+			want: map[string]interface{}{"int": 1, "a": "A", "b": "B"}, wantBulk: [][]string{{"a", "b", "c"}}},
+		{name: "bulk hit", loader: &mapBulkLoader{mapLoader: mapLoader{values: values}}, keys: []string{"int", "string"},
+			want: map[string]interface{}{"int": 1, "string": "a"}},
+		{name: "bulk load error", loader: &mapBulkLoader{mapLoader: mapLoader{err: errLoad}}, keys: []string{"int", "a"},
+			want: map[string]interface{}{"int": 1}, wantErr: errLoad, wantBulk: [][]string{{"a"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c ICache
+			if tt.loader != nil {
+				c = mockCache(WithLoader(tt.loader))
+			} else {
+				c = mockCache()
+			}
+			got, err := c.MGetE(tt.keys...)
+			if !reflect.DeepEqual(got, tt.want) || err != tt.wantErr {
+				t.Errorf("MGetE() = %v, %v, want %v, %v", got, err, tt.want, tt.wantErr)
+			}
+			if bulk, ok := tt.loader.(*mapBulkLoader); ok && !reflect.DeepEqual(bulk.keys, tt.wantBulk) {
+				t.Errorf("LoadAll() keys = %v, want %v", bulk.keys, tt.wantBulk)
+			}
+			if tt.wantErr == nil {
+				for k, v := range tt.want {
+					if got, ok := c.Get(k); !ok || got != v {
+						t.Errorf("Get(%q) = %v, %v, want %v, %v", k, got, ok, v, true)
+					}
+				}
+			}
+		})
+	}
+}
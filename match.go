@@ -0,0 +1,98 @@
+package cache
+
+import "strings"
+
+// matchGlob reports whether s matches the Redis glob-style pattern, byte by byte:
+// * matches any sequence, ? matches any byte, [abc], [a-c] and [^abc] match a byte of a set,
+// and \ escapes the special meaning of the byte after it.
+func matchGlob(pattern, s string) bool {
+	var p, i int
+	// star is the position in pattern after the last *, -1 if none, and next the position in s it resumes from.
+	star, next := -1, 0
+	for i < len(s) {
+		if p < len(pattern) {
+			if pattern[p] == '*' {
+				p++
+				star, next = p, i
+				continue
+			}
+			if n, ok := matchByte(pattern[p:], s[i]); ok {
+				p += n
+				i++
+				continue
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		// Let the last * match one more byte, and retry the rest of the pattern.
+		next++
+		p, i = star, next
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchByte reports whether c matches the first element of pattern, which is not a *,
+// and returns the length of that element.
+func matchByte(pattern string, c byte) (int, bool) {
+	switch pattern[0] {
+	case '?':
+		return 1, true
+	case '\\':
+		if len(pattern) > 1 {
+			return 2, pattern[1] == c
+		}
+		return 1, c == '\\'
+	case '[':
+		return matchClass(pattern, c)
+	}
+	return 1, pattern[0] == c
+}
+
+// matchClass reports whether c belongs to the set at the start of pattern, e.g. [abc], [a-z] or [^abc],
+// and returns the length of the set. A set missing its ] ends with the pattern.
+func matchClass(pattern string, c byte) (int, bool) {
+	j := 1
+	negate := j < len(pattern) && pattern[j] == '^'
+	if negate {
+		j++
+	}
+	var match bool
+	for j < len(pattern) && pattern[j] != ']' {
+		switch {
+		case pattern[j] == '\\' && j+1 < len(pattern):
+			match = match || pattern[j+1] == c
+			j += 2
+		case j+2 < len(pattern) && pattern[j+1] == '-' && pattern[j+2] != ']':
+			lo, hi := pattern[j], pattern[j+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			match = match || (lo <= c && c <= hi)
+			j += 3
+		default:
+			match = match || pattern[j] == c
+			j++
+		}
+	}
+	if j < len(pattern) {
+		j++
+	}
+	return j, match != negate
+}
+
+// globPrefix returns the literal prefix of pattern if pattern is that prefix followed by a single trailing *,
+// so that matching it is a prefix test.
+func globPrefix(pattern string) (string, bool) {
+	if !strings.HasSuffix(pattern, "*") {
+		return "", false
+	}
+	prefix := pattern[:len(pattern)-1]
+	if strings.ContainsAny(prefix, `*?[\`) {
+		return "", false
+	}
+	return prefix, true
+}
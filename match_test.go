@@ -0,0 +1,73 @@
+package cache
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{pattern: "*", s: "", want: true},
+		{pattern: "*", s: "abc", want: true},
+		{pattern: "", s: "", want: true},
+		{pattern: "", s: "a", want: false},
+		{pattern: "abc", s: "abc", want: true},
+		{pattern: "abc", s: "abd", want: false},
+		{pattern: "a*", s: "abc", want: true},
+		{pattern: "*c", s: "abc", want: true},
+		{pattern: "a*c", s: "ac", want: true},
+		{pattern: "a*c", s: "abcbc", want: true},
+		{pattern: "a*c", s: "abcb", want: false},
+		{pattern: "a**b", s: "axxb", want: true},
+		{pattern: "*a*b*", s: "xxaxxbxx", want: true},
+		{pattern: "h?llo", s: "hello", want: true},
+		{pattern: "h?llo", s: "hllo", want: false},
+		{pattern: "h[ae]llo", s: "hallo", want: true},
+		{pattern: "h[ae]llo", s: "hillo", want: false},
+		{pattern: "h[^e]llo", s: "hallo", want: true},
+		{pattern: "h[^e]llo", s: "hello", want: false},
+		{pattern: "h[a-b]llo", s: "hbllo", want: true},
+		{pattern: "h[b-a]llo", s: "hallo", want: true},
+		{pattern: "h[a-b]llo", s: "hcllo", want: false},
+		{pattern: "h[\\]]llo", s: "h]llo", want: true},
+		{pattern: "h[a-]llo", s: "h-llo", want: true},
+		{pattern: "h[ab", s: "hb", want: true},
+		{pattern: "\\*", s: "*", want: true},
+		{pattern: "\\*", s: "a", want: false},
+		{pattern: "a\\?c", s: "abc", want: false},
+		{pattern: "a\\", s: "a\\", want: true},
+		{pattern: "user:*:name", s: "user:1:name", want: true},
+		{pattern: "user:*:name", s: "user:1:age", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.s, func(t *testing.T) {
+			if got := matchGlob(tt.pattern, tt.s); got != tt.want {
+				t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGlobPrefix(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+		want1   bool
+	}{
+		{pattern: "user:*", want: "user:", want1: true},
+		{pattern: "*", want: "", want1: true},
+		{pattern: "user:", want: "", want1: false},
+		{pattern: "user:?*", want: "", want1: false},
+		{pattern: "user\\*", want: "", want1: false},
+		{pattern: "*:name", want: "", want1: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, got1 := globPrefix(tt.pattern)
+			if got != tt.want || got1 != tt.want1 {
+				t.Errorf("globPrefix() = %q, %v, want %q, %v", got, got1, tt.want, tt.want1)
+			}
+		})
+	}
+}
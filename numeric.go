@@ -0,0 +1,96 @@
+package cache
+
+import "fmt"
+
+// NotNumericError is returned by IncrBy, DecrBy and IncrByFloat when the value stored at key is not a number
+type NotNumericError struct {
+	Key   string
+	Value interface{}
+}
+
+func (e *NotNumericError) Error() string {
+	return fmt.Sprintf("cache: value of key %q is a %T, not a number", e.Key, e.Value)
+}
+
+// addInt adds delta to a numeric value, keeping its type. Integers wrap around on overflow.
+// It returns the new value and the new value converted to an int64, truncated for a float and wrapped around
+// for a uint or uint64 above math.MaxInt64, false if v is not a number.
+func addInt(v interface{}, delta int64) (interface{}, int64, bool) {
+	switch n := v.(type) {
+	case int:
+		n += int(delta)
+		return n, int64(n), true
+	case int8:
+		n += int8(delta)
+		return n, int64(n), true
+	case int16:
+		n += int16(delta)
+		return n, int64(n), true
+	case int32:
+		n += int32(delta)
+		return n, int64(n), true
+	case int64:
+		n += delta
+		return n, n, true
+	case uint:
+		n += uint(delta)
+		return n, int64(n), true
+	case uint8:
+		n += uint8(delta)
+		return n, int64(n), true
+	case uint16:
+		n += uint16(delta)
+		return n, int64(n), true
+	case uint32:
+		n += uint32(delta)
+		return n, int64(n), true
+	case uint64:
+		n += uint64(delta)
+		return n, int64(n), true
+	case float32:
+		n += float32(delta)
+		return n, int64(n), true
+	case float64:
+		n += float64(delta)
+		return n, int64(n), true
+	}
+	return nil, 0, false
+}
+
+// addFloat adds delta to a numeric value. Floats keep their type, integers become a float64.
+// It returns the new value and the new value as a float64, false if v is not a number.
+func addFloat(v interface{}, delta float64) (interface{}, float64, bool) {
+	var f float64
+	switch n := v.(type) {
+	case float32:
+		n += float32(delta)
+		return n, float64(n), true
+	case float64:
+		n += delta
+		return n, n, true
+	case int:
+		f = float64(n)
+	case int8:
+		f = float64(n)
+	case int16:
+		f = float64(n)
+	case int32:
+		f = float64(n)
+	case int64:
+		f = float64(n)
+	case uint:
+		f = float64(n)
+	case uint8:
+		f = float64(n)
+	case uint16:
+		f = float64(n)
+	case uint32:
+		f = float64(n)
+	case uint64:
+		f = float64(n)
+	default:
+		return nil, 0, false
+	}
+	f += delta
+	return f, f, true
+}
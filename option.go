@@ -3,6 +3,8 @@ package cache
 import "time"
 
 // SetIOption The option used to cache set
+// The options are evaluated while the shard holding the key is locked, so they must not call the cache.
+// The value is only set if every option returns true.
 type SetIOption func(ICache, string, IItem) bool
 
 //WithEx Set the specified expire time, in time.Duration.
@@ -21,6 +23,102 @@ func WithExAt(t time.Time) SetIOption {
 	}
 }
 
+//WithSlidingEx Set the specified idle time, in time.Duration: the key expires once it has not been read for d.
+//Every successful Get, and Touch, restarts the expiration. It replaces the expire time given by the other options.
+func WithSlidingEx(d time.Duration) SetIOption {
+	return func(c ICache, k string, v IItem) bool {
+		item := v.(*setting)
+		now := time.Now()
+		e := item.extend()
+		item.expire, e.soft, e.staleFor = now.Add(d), time.Time{}, 0
+		e.sliding, e.accessed = d, now.UnixNano()
+		return true
+	}
+}
+
+//WithSoftEx Set the specified soft expire time, in time.Duration.
+//Past it the value is stale: Get still returns it, GetWithStale flags it,
+//and a read reloads it in the background when the cache has a Loader.
+//The key expires WithStaleFor later, or at the time given by WithEx if it is later.
+func WithSoftEx(d time.Duration) SetIOption {
+	return func(c ICache, k string, v IItem) bool {
+		item := v.(*setting)
+		e := item.extend()
+		e.soft = time.Now().Add(d)
+		if hard := e.soft.Add(e.staleFor); item.expire.IsZero() || item.expire.Before(hard) {
+			item.expire = hard
+		}
+		return true
+	}
+}
+
+//WithStaleFor Set how long the value is served stale after its soft expire time, given by WithSoftEx.
+//Without WithSoftEx, the time given by WithEx becomes the soft expire time.
+//The stale value is also served while the Loader fails to reload it, until the key expires.
+func WithStaleFor(d time.Duration) SetIOption {
+	return func(c ICache, k string, v IItem) bool {
+		item := v.(*setting)
+		e := item.extend()
+		e.staleFor = d
+		if e.soft.IsZero() {
+			e.soft = item.expire
+		}
+		if !e.soft.IsZero() {
+			item.expire = e.soft.Add(d)
+		}
+		return true
+	}
+}
+
+//WithKeepTTL Retain the time to live associated with the key.
+func WithKeepTTL() SetIOption {
+	return func(c ICache, k string, v IItem) bool {
+		item := v.(*setting)
+		if prev := item.prev; item.exists() {
+			item.expire, item.extra = prev.expire, prev.extra
+			//The refresh ahead is scheduled again for the new value.
+			if !item.ext().refresh.IsZero() {
+				item.extend().refresh = time.Time{}
+			}
+		}
+		return true
+	}
+}
+
+//WithJitter Cut a random part of the time to live, up to fraction of it, so that keys set together do not expire together.
+//It overrides WithDefaultJitter, WithJitter(0) disables it. A time to live kept by WithKeepTTL is not cut again.
+func WithJitter(fraction float64) SetIOption {
+	if fraction < 0 || fraction > 1 {
+		panic("Invalid jitter")
+	}
+	return func(c ICache, k string, v IItem) bool {
+		v.(*setting).jitter = &fraction
+		return true
+	}
+}
+
+//WithNx Only set the key if it does not already exist.
+func WithNx() SetIOption {
+	return func(c ICache, k string, v IItem) bool {
+		return !v.(*setting).exists()
+	}
+}
+
+//WithXx Only set the key if it already exists.
+func WithXx() SetIOption {
+	return func(c ICache, k string, v IItem) bool {
+		return v.(*setting).exists()
+	}
+}
+
+//WithCost Set the cost of the value, instead of estimating it with the Sizer.
+func WithCost(cost int64) SetIOption {
+	return func(c ICache, k string, v IItem) bool {
+		v.SetCost(cost)
+		return true
+	}
+}
+
 // ICacheOption The option used to create the cache object
 type ICacheOption func(conf *Config)
 
@@ -39,13 +137,82 @@ func WithShards(shards int) ICacheOption {
 //WithExpiredCallback set custom expired callback function
 //This callback function is called when the key-value pair expires
 func WithExpiredCallback(ec ExpiredCallback) ICacheOption {
+	return WithExpiredCallbackOf[string, interface{}](ec)
+}
+
+//WithExpiredCallbackOf set custom expired callback function of a Cache, see WithExpiredCallback
+func WithExpiredCallbackOf[K comparable, V any](ec func(k K, v V) error) ICacheOption {
 	return func(conf *Config) {
-		conf.expiredCallback = ec
+		conf.expiredCallback = nil
+		if ec != nil {
+			conf.expiredCallback = func(k K, v interface{}) error { return ec(k, cast[V](v)) }
+		}
+	}
+}
+
+//WithRemovalListener set custom removal listener function
+//This listener function is called whenever a key-value pair leaves the cache, with the reason of the removal:
+//Expired, Evicted, Deleted, Replaced or Flushed
+func WithRemovalListener(rl RemovalListener) ICacheOption {
+	return WithRemovalListenerOf[string, interface{}](rl)
+}
+
+//WithRemovalListenerOf set custom removal listener function of a Cache, see WithRemovalListener
+func WithRemovalListenerOf[K comparable, V any](rl func(k K, v V, reason RemovalReason) error) ICacheOption {
+	return func(conf *Config) {
+		conf.removalListener = nil
+		if rl != nil {
+			conf.removalListener = func(k K, v interface{}, reason RemovalReason) error { return rl(k, cast[V](v), reason) }
+		}
+	}
+}
+
+//WithCallbackWorkers run the expired callback and the removal listener on a pool of workers goroutines,
+//queueing up to queueLen callbacks, instead of the goroutine which removed the key.
+//A slow callback then neither stalls the periodic clearing nor the callers of Get.
+//Callbacks of the same key may run out of order when workers > 1. Default is 0, synchronous callbacks
+func WithCallbackWorkers(workers, queueLen int) ICacheOption {
+	if workers < 0 || queueLen < 0 {
+		panic("Invalid callback workers")
+	}
+	return func(conf *Config) {
+		conf.callbackWorkers = workers
+		conf.callbackQueueLen = queueLen
+	}
+}
+
+//WithCallbackOverflow set what to do with a callback when the queue of WithCallbackWorkers is full.
+//Default is OverflowBlock
+func WithCallbackOverflow(overflow OverflowStrategy) ICacheOption {
+	return func(conf *Config) {
+		conf.callbackOverflow = overflow
+	}
+}
+
+//WithCallbackErrorHandler set custom function handling the errors returned by the expired callback and the removal listener.
+//By default the errors are discarded
+func WithCallbackErrorHandler(h CallbackErrorHandler) ICacheOption {
+	return WithCallbackErrorHandlerOf[string, interface{}](h)
+}
+
+//WithCallbackErrorHandlerOf set custom function handling the errors of the callbacks of a Cache, see WithCallbackErrorHandler
+func WithCallbackErrorHandlerOf[K comparable, V any](h func(k K, v V, err error)) ICacheOption {
+	return func(conf *Config) {
+		conf.callbackErrorHandler = nil
+		if h != nil {
+			conf.callbackErrorHandler = func(k K, v interface{}, err error) { h(k, cast[V](v), err) }
+		}
 	}
 }
 
 //WithHash set custom hash key function
 func WithHash(hash IHash) ICacheOption {
+	return WithHasher[string](hash)
+}
+
+//WithHasher set custom hash key function of a Cache.
+//The default is FNV-1a for string keys, and maphash.Comparable with a random seed for other keys
+func WithHasher[K comparable](hash Hasher[K]) ICacheOption {
 	return func(conf *Config) {
 		conf.hash = hash
 	}
@@ -59,3 +226,170 @@ func WithClearInterval(d time.Duration) ICacheOption {
 		conf.clearInterval = d
 	}
 }
+
+//WithMaxEntries set the maximum number of key-value pairs held by the cache. Default is 0, unlimited.
+//The budget is split evenly across the shards, their shares adding up to n, and a shard evicts its least recently used key
+//once its share is exceeded. Get counts as a use. See WithPolicy for other eviction algorithms.
+//When n is smaller than the number of shards, the cache uses fewer shards, so that each one holds at least one key.
+func WithMaxEntries(n int) ICacheOption {
+	if n < 0 {
+		panic("Invalid max entries")
+	}
+	return func(conf *Config) {
+		conf.maxEntries = n
+	}
+}
+
+//WithMaxCost set the maximum total cost of the key-value pairs held by the cache, usually in bytes. Default is 0, unlimited.
+//Once the total cost is exceeded, the shards take turns evicting their least recently used key until it fits.
+//Each key evicted is the least recently used of its shard, not of the whole cache: the order is only LRU with WithShards(1).
+//A value whose cost alone exceeds the maximum is not stored, and Set returns false.
+func WithMaxCost(cost int64) ICacheOption {
+	if cost < 0 {
+		panic("Invalid max cost")
+	}
+	return func(conf *Config) {
+		conf.maxCost = cost
+	}
+}
+
+//WithSizer set custom function estimating the cost of a value. Default is exact for []byte and string,
+//and walks other values with reflection
+func WithSizer(sizer Sizer) ICacheOption {
+	return func(conf *Config) {
+		conf.sizer = sizer
+	}
+}
+
+//WithPolicy set the algorithm choosing the keys to evict once WithMaxEntries or WithMaxCost is exceeded. Default is PolicyLRU
+func WithPolicy(p Policy) ICacheOption {
+	return func(conf *Config) {
+		conf.policy, conf.newPolicy = p, nil
+	}
+}
+
+//WithEvictionPolicy set custom algorithm choosing the keys to evict once WithMaxEntries or WithMaxCost is exceeded.
+//newPolicy is called once per shard, with the shard's share of the entries budget, or 0 when only the cost is bounded.
+//The built-in policies can be used directly, e.g. WithEvictionPolicy(NewARCPolicy)
+func WithEvictionPolicy(newPolicy func(capacity int) EvictionPolicy) ICacheOption {
+	return WithEvictionPolicyOf[string](newPolicy)
+}
+
+//WithEvictionPolicyOf set custom algorithm choosing the keys of a Cache to evict, see WithEvictionPolicy
+func WithEvictionPolicyOf[K comparable](newPolicy func(capacity int) EvictionPolicyOf[K]) ICacheOption {
+	return func(conf *Config) {
+		conf.newPolicy = nil
+		if newPolicy != nil {
+			conf.newPolicy = newPolicy
+		}
+	}
+}
+
+//WithLoader set the loader of a read-through cache.
+//Get, GetE, MGet and MGetE load the missing keys with loader, store and return them.
+//Concurrent loads of the same key share a single call of loader, except in LoadAll of a BulkLoader
+func WithLoader(loader Loader) ICacheOption {
+	return WithLoaderOf[string, interface{}](loader)
+}
+
+//WithLoaderOf set the loader of a read-through Cache, see WithLoader
+func WithLoaderOf[K comparable, V any](loader LoaderOf[K, V]) ICacheOption {
+	return func(conf *Config) {
+		conf.loader = toAnyLoader(loader)
+	}
+}
+
+//WithWriteThrough set the Store the cache is the front of, written synchronously.
+//Every write and deletion is written to the store under the lock of the key's shard, and fails if the store fails:
+//Set returns false, IncrBy returns the error of the store, Del does not count the key.
+//MSetNX writes all its keys with a single WriteBatch, which should be atomic for the store to stay all-or-nothing too.
+func WithWriteThrough(store Store) ICacheOption {
+	return WithWriteThroughOf[string, interface{}](store)
+}
+
+//WithWriteThroughOf set the StoreOf a Cache, written synchronously, see WithWriteThrough
+func WithWriteThroughOf[K comparable, V any](store StoreOf[K, V]) ICacheOption {
+	return func(conf *Config) {
+		conf.store = toAnyStore(store)
+		conf.writeBehindInterval, conf.writeBehindBatch = 0, 0
+	}
+}
+
+//WithWriteBehind set the Store the cache is the front of, written asynchronously.
+//Writes are queued, keeping only the last one of each key, and written with WriteBatch every interval,
+//as soon as batchSize keys are pending, and on Close. See WithStoreErrorHandler for the errors of the store
+func WithWriteBehind(store Store, interval time.Duration, batchSize int) ICacheOption {
+	return WithWriteBehindOf[string, interface{}](store, interval, batchSize)
+}
+
+//WithWriteBehindOf set the StoreOf a Cache, written asynchronously, see WithWriteBehind
+func WithWriteBehindOf[K comparable, V any](store StoreOf[K, V], interval time.Duration, batchSize int) ICacheOption {
+	if interval <= 0 {
+		panic("Invalid write behind interval")
+	}
+	if batchSize <= 0 {
+		panic("Invalid write behind batch size")
+	}
+	return func(conf *Config) {
+		conf.store = toAnyStore(store)
+		conf.writeBehindInterval, conf.writeBehindBatch = interval, batchSize
+	}
+}
+
+//WithStoreErrorHandler set the function handling the errors of the Store given to WithWriteBehind.
+//Default is nil, the failed batches are dropped
+func WithStoreErrorHandler(h StoreErrorHandler) ICacheOption {
+	return WithStoreErrorHandlerOf[string, interface{}](h)
+}
+
+//WithStoreErrorHandlerOf set the function handling the errors of the StoreOf a Cache, see WithStoreErrorHandler
+func WithStoreErrorHandlerOf[K comparable, V any](h func(batch []StoreWriteOf[K, V], err error)) ICacheOption {
+	return func(conf *Config) {
+		conf.storeErrorHandler = nil
+		if h != nil {
+			conf.storeErrorHandler = func(batch []StoreWriteOf[K, interface{}], err error) { h(typedWrites[K, V](batch), err) }
+		}
+	}
+}
+
+//WithRefreshAhead set the fraction of the time to live of a key after which a read reloads it in the background.
+//It requires WithLoader: Get, GetE, MGet and MGetE keep returning the current value while the loader runs,
+//and concurrent refreshes of a key share a single call of the loader. The reloaded value is dropped if the key is written meanwhile
+func WithRefreshAhead(fraction float64) ICacheOption {
+	if fraction <= 0 || fraction >= 1 {
+		panic("Invalid refresh ahead fraction")
+	}
+	return func(conf *Config) {
+		conf.refreshAhead = fraction
+	}
+}
+
+//WithNegativeTTL set how long a key is remembered as not found when the Loader returns ErrNotFound,
+//or when it is missing from the result of LoadAll. Until then reads return not found without calling the loader,
+//and the key does not exist for Exists and ToMap. Default is 0, misses are not remembered
+func WithNegativeTTL(d time.Duration) ICacheOption {
+	if d < 0 {
+		panic("Invalid negative ttl")
+	}
+	return func(conf *Config) {
+		conf.negativeTTL = d
+	}
+}
+
+//WithDefaultJitter set the fraction of the time to live randomly cut from every key set with an expire time,
+//see WithJitter. Default is 0, no jitter
+func WithDefaultJitter(fraction float64) ICacheOption {
+	if fraction < 0 || fraction > 1 {
+		panic("Invalid jitter")
+	}
+	return func(conf *Config) {
+		conf.jitter = fraction
+	}
+}
+
+//WithJitterSeed set the seed of the random numbers of the jitter, so that it is reproducible. Default is the current time
+func WithJitterSeed(seed int64) ICacheOption {
+	return func(conf *Config) {
+		conf.jitterSeed = seed
+	}
+}
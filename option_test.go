@@ -1,7 +1,13 @@
 package cache
 
 import (
+	"context"
+	"errors"
 	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -205,3 +211,1052 @@ func TestWithClearInterval(t *testing.T) {
 		})
 	}
 }
+
+func TestWithMaxEntries(t *testing.T) {
+	type args struct {
+		maxEntries int
+	}
+	tests := []struct {
+		name string
+		args args
+		do   func(c ICache)
+		want map[string]interface{}
+	}{
+		{name: "unlimited", args: args{maxEntries: 0},
+			do: func(c ICache) {
+				c.Set("a", 1)
+				c.Set("b", 2)
+				c.Set("c", 3)
+			},
+			want: map[string]interface{}{"a": 1, "b": 2, "c": 3}},
+		{name: "evict oldest", args: args{maxEntries: 2},
+			do: func(c ICache) {
+				c.Set("a", 1)
+				c.Set("b", 2)
+				c.Set("c", 3)
+			},
+			want: map[string]interface{}{"b": 2, "c": 3}},
+		{name: "get is a use", args: args{maxEntries: 2},
+			do: func(c ICache) {
+				c.Set("a", 1)
+				c.Set("b", 2)
+				c.Get("a")
+				c.Set("c", 3)
+			},
+			want: map[string]interface{}{"a": 1, "c": 3}},
+		{name: "overwrite is a use", args: args{maxEntries: 2},
+			do: func(c ICache) {
+				c.Set("a", 1)
+				c.Set("b", 2)
+				c.Set("a", 3)
+				c.Set("c", 3)
+			},
+			want: map[string]interface{}{"a": 3, "c": 3}},
+		{name: "del frees room", args: args{maxEntries: 2},
+			do: func(c ICache) {
+				c.Set("a", 1)
+				c.Set("b", 2)
+				c.Del("a")
+				c.Set("c", 3)
+			},
+			want: map[string]interface{}{"b": 2, "c": 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemCache(WithShards(1), WithMaxEntries(tt.args.maxEntries))
+			tt.do(c)
+			if got := c.ToMap(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WithMaxEntries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithMaxEntries_Shards(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxEntries int
+	}{
+		{name: "fewer than the shards", maxEntries: 10},
+		{name: "one", maxEntries: 1},
+		{name: "remainder", maxEntries: 1030},
+		{name: "multiple of the shards", maxEntries: 2048},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemCache(WithMaxEntries(tt.maxEntries))
+			for i := 0; i < 20*tt.maxEntries; i++ {
+				c.Set(strconv.Itoa(i), i)
+			}
+			if got := c.Len(); got != tt.maxEntries {
+				t.Errorf("Len() = %v, want %v", got, tt.maxEntries)
+			}
+		})
+	}
+}
+
+func TestWithCost(t *testing.T) {
+	type args struct {
+		v   interface{}
+		opt SetIOption
+	}
+	tests := []struct {
+		name string
+		args args
+		want int64
+	}{
+		{name: "sizer", args: args{v: "value", opt: WithEx(time.Second)}, want: 5},
+		{name: "cost", args: args{v: "value", opt: WithCost(10)}, want: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemCache(WithMaxCost(1024))
+			c.Set("k", tt.args.v, tt.args.opt)
+			if got := c.Cost(); got != tt.want {
+				t.Errorf("Cost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithMaxCost(t *testing.T) {
+	type args struct {
+		maxCost int64
+	}
+	tests := []struct {
+		name     string
+		args     args
+		do       func(c ICache)
+		want     map[string]interface{}
+		wantCost int64
+	}{
+		{name: "fits", args: args{maxCost: 10},
+			do: func(c ICache) {
+				c.Set("a", "aaaaa")
+				c.Set("b", "bbbbb")
+			},
+			want: map[string]interface{}{"a": "aaaaa", "b": "bbbbb"}, wantCost: 10},
+		{name: "evict oldest", args: args{maxCost: 10},
+			do: func(c ICache) {
+				c.Set("a", "aaaaa")
+				c.Set("b", "bbbbb")
+				c.Set("c", "c")
+			},
+			want: map[string]interface{}{"b": "bbbbb", "c": "c"}, wantCost: 6},
+		{name: "get is a use", args: args{maxCost: 15},
+			do: func(c ICache) {
+				c.Set("a", "aaaaa")
+				c.Set("b", "bbbbb")
+				c.Set("c", "ccccc")
+				c.Get("a")
+				c.Get("b")
+				c.Set("d", "ddddd")
+			},
+			want: map[string]interface{}{"a": "aaaaa", "b": "bbbbb", "d": "ddddd"}, wantCost: 15},
+		{name: "evict until it fits", args: args{maxCost: 10},
+			do: func(c ICache) {
+				c.Set("a", "aaaaa")
+				c.Set("b", "bbbbb")
+				c.Set("c", "cccccccc")
+			},
+			want: map[string]interface{}{"c": "cccccccc"}, wantCost: 8},
+		{name: "too large", args: args{maxCost: 10},
+			do: func(c ICache) {
+				c.Set("a", "aaaaa")
+				c.Set("b", "bbbbbbbbbbb")
+			},
+			want: map[string]interface{}{"a": "aaaaa"}, wantCost: 5},
+		{name: "overwrite", args: args{maxCost: 10},
+			do: func(c ICache) {
+				c.Set("a", "aaaaa")
+				c.Set("a", "aa")
+			},
+			want: map[string]interface{}{"a": "aa"}, wantCost: 2},
+		{name: "del", args: args{maxCost: 10},
+			do: func(c ICache) {
+				c.Set("a", "aaaaa")
+				c.Set("b", "bbbbb")
+				c.Del("a")
+			},
+			want: map[string]interface{}{"b": "bbbbb"}, wantCost: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemCache(WithShards(1), WithMaxCost(tt.args.maxCost))
+			tt.do(c)
+			if got := c.ToMap(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WithMaxCost() = %v, want %v", got, tt.want)
+			}
+			if got := c.Cost(); got != tt.wantCost {
+				t.Errorf("Cost() = %v, want %v", got, tt.wantCost)
+			}
+		})
+	}
+}
+
+type sizer1 struct {
+}
+
+func (s sizer1) Size(v interface{}) int64 {
+	return 1
+}
+
+func TestWithSizer(t *testing.T) {
+	tests := []struct {
+		name  string
+		sizer Sizer
+		want  int64
+	}{
+		{name: "default", sizer: newDefaultSizer(), want: 8},
+		{name: "custom", sizer: sizer1{}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemCache(WithMaxCost(1024), WithSizer(tt.sizer))
+			c.Set("a", "aaaa")
+			c.Set("b", "bbbb")
+			if got := c.Cost(); got != tt.want {
+				t.Errorf("Cost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithEvictionPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  ICacheOption
+		want map[string]interface{}
+	}{
+		{name: "lru", opt: WithPolicy(PolicyLRU), want: map[string]interface{}{"a": 1, "c": 3}},
+		{name: "fifo", opt: WithPolicy(PolicyFIFO), want: map[string]interface{}{"b": 2, "c": 3}},
+		{name: "custom", opt: WithEvictionPolicy(NewFIFOPolicy), want: map[string]interface{}{"b": 2, "c": 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemCache(WithShards(1), WithMaxEntries(2), tt.opt)
+			c.Set("a", 1)
+			c.Set("b", 2)
+			c.Get("a")
+			c.Set("c", 3)
+			if got := c.ToMap(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WithEvictionPolicy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// unknownVictimPolicy is a misbehaving EvictionPolicy, choosing a key the cache does not hold.
+type unknownVictimPolicy struct {
+	EvictionPolicy
+}
+
+func (p unknownVictimPolicy) Victim() (string, bool) {
+	return "unknown", true
+}
+
+func TestWithEvictionPolicy_UnknownVictim(t *testing.T) {
+	c := NewMemCache(WithShards(1), WithMaxEntries(2), WithEvictionPolicy(func(capacity int) EvictionPolicy {
+		return unknownVictimPolicy{NewFIFOPolicy(capacity)}
+	}))
+	done := make(chan struct{})
+	go func() {
+		c.Set("a", 1)
+		c.Set("b", 2)
+		c.Set("c", 3)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Set() did not return")
+	}
+	want := []string{"a", "b", "c"}
+	var got []string
+	var cursor uint64
+	for {
+		var keys []string
+		cursor, keys = c.Scan(cursor, "*", 10)
+		got = append(got, keys...)
+		if cursor == 0 {
+			break
+		}
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Scan() = %v, want %v", got, want)
+	}
+}
+
+func TestWithRemovalListener(t *testing.T) {
+	var c ICache
+	type event struct {
+		k      string
+		v      interface{}
+		reason RemovalReason
+	}
+	tests := []struct {
+		name string
+		opts []ICacheOption
+		do   func()
+		want []event
+	}{
+		{name: "deleted", do: func() {
+			c.Set("a", 1)
+			c.Del("a", "b")
+		}, want: []event{{k: "a", v: 1, reason: Deleted}}},
+		{name: "get del", do: func() {
+			c.Set("a", 1)
+			c.GetDel("a")
+		}, want: []event{{k: "a", v: 1, reason: Deleted}}},
+		{name: "replaced", do: func() {
+			c.Set("a", 1)
+			c.Set("a", 2)
+		}, want: []event{{k: "a", v: 1, reason: Replaced}}},
+		{name: "expired", do: func() {
+			c.Set("a", 1, WithEx(10*time.Millisecond))
+			time.Sleep(10 * time.Millisecond)
+			c.Get("a")
+		}, want: []event{{k: "a", v: 1, reason: Expired}}},
+		{name: "expired by clear interval", opts: []ICacheOption{WithClearInterval(10 * time.Millisecond)}, do: func() {
+			c.Set("a", 1, WithEx(10*time.Millisecond))
+			time.Sleep(50 * time.Millisecond)
+		}, want: []event{{k: "a", v: 1, reason: Expired}}},
+		{name: "replaced after expiry", do: func() {
+			c.Set("a", 1, WithEx(10*time.Millisecond))
+			time.Sleep(10 * time.Millisecond)
+			c.Set("a", 2)
+		}, want: []event{{k: "a", v: 1, reason: Expired}}},
+		{name: "evicted", opts: []ICacheOption{WithShards(1), WithMaxEntries(1)}, do: func() {
+			c.Set("a", 1)
+			c.Set("b", 2)
+		}, want: []event{{k: "a", v: 1, reason: Evicted}}},
+		{name: "evicted by cost", opts: []ICacheOption{WithShards(1), WithMaxCost(1)}, do: func() {
+			c.Set("a", "a")
+			c.Set("b", "b")
+		}, want: []event{{k: "a", v: "a", reason: Evicted}}},
+		{name: "flushed", do: func() {
+			c.Set("a", 1)
+			c.Flush()
+		}, want: []event{{k: "a", v: 1, reason: Flushed}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lock sync.Mutex
+			var got []event
+			rl := func(k string, v interface{}, reason RemovalReason) error {
+				lock.Lock()
+				got = append(got, event{k: k, v: v, reason: reason})
+				lock.Unlock()
+				return nil
+			}
+			c = NewMemCache(append(tt.opts, WithRemovalListener(rl))...)
+			tt.do()
+			lock.Lock()
+			defer lock.Unlock()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WithRemovalListener() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithCallbackWorkers(t *testing.T) {
+	release := make(chan struct{})
+	done := make(chan string, 1)
+	ec := func(k string, v interface{}) error {
+		<-release
+		done <- k
+		return nil
+	}
+	c := NewMemCache(WithExpiredCallback(ec), WithCallbackWorkers(1, 1), WithClearInterval(0))
+	c.Set("a", 1, WithEx(time.Millisecond))
+	time.Sleep(time.Millisecond)
+	// The slow callback runs on the worker, so Get does not wait for it.
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Get() = %v, want %v", ok, false)
+	}
+	close(release)
+	select {
+	case k := <-done:
+		if k != "a" {
+			t.Errorf("ExpiredCallback() k = %v, want %v", k, "a")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("ExpiredCallback() was not called")
+	}
+}
+
+func TestWithCallbackOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		overflow OverflowStrategy
+		// blocked tells whether the removal overflowing the queue waits for the worker.
+		blocked bool
+		want    []string
+	}{
+		{name: "block", overflow: OverflowBlock, blocked: true, want: []string{"a", "b", "c"}},
+		{name: "drop", overflow: OverflowDrop, want: []string{"a", "b"}},
+		{name: "run inline", overflow: OverflowRunInline, want: []string{"c", "a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lock sync.Mutex
+			var got []string
+			started, release := make(chan struct{}), make(chan struct{})
+			rl := func(k string, v interface{}, reason RemovalReason) error {
+				if k == "a" {
+					close(started)
+					<-release
+				}
+				lock.Lock()
+				got = append(got, k)
+				lock.Unlock()
+				return nil
+			}
+			c := NewMemCache(WithRemovalListener(rl), WithCallbackWorkers(1, 1), WithCallbackOverflow(tt.overflow))
+			c.Set("a", 1)
+			c.Set("b", 1)
+			c.Set("c", 1)
+			c.Del("a")
+			<-started
+			c.Del("b")
+			deleted := make(chan struct{})
+			go func() {
+				c.Del("c")
+				close(deleted)
+			}()
+			select {
+			case <-deleted:
+				if tt.blocked {
+					t.Errorf("Del() returned while the queue is full")
+				}
+			case <-time.After(50 * time.Millisecond):
+				if !tt.blocked {
+					t.Errorf("Del() blocked while the queue is full")
+				}
+			}
+			close(release)
+			<-deleted
+			for i := 0; i < 100; i++ {
+				lock.Lock()
+				n := len(got)
+				lock.Unlock()
+				if n >= len(tt.want) {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			time.Sleep(10 * time.Millisecond)
+			lock.Lock()
+			defer lock.Unlock()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WithCallbackOverflow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithCallbackErrorHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ICacheOption
+	}{
+		{name: "sync"},
+		{name: "workers", opts: []ICacheOption{WithCallbackWorkers(1, 10)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := make(chan error, 1)
+			rl := func(k string, v interface{}, reason RemovalReason) error {
+				return errors.New(k)
+			}
+			h := func(k string, v interface{}, err error) {
+				errs <- err
+			}
+			c := NewMemCache(append(tt.opts, WithRemovalListener(rl), WithCallbackErrorHandler(h))...)
+			c.Set("a", 1)
+			c.Del("a")
+			select {
+			case err := <-errs:
+				if err.Error() != "a" {
+					t.Errorf("CallbackErrorHandler() err = %v, want %v", err, "a")
+				}
+			case <-time.After(time.Second):
+				t.Errorf("CallbackErrorHandler() was not called")
+			}
+		})
+	}
+}
+
+func TestWithNx(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		want  bool
+		wantV interface{}
+	}{
+		{name: "exists", key: "int", want: false, wantV: 1},
+		{name: "expired", key: "ex", want: true, wantV: 2},
+		{name: "null", key: "null", want: true, wantV: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockCache()
+			c.Set("ex", 1, WithEx(time.Nanosecond))
+			if got := c.Set(tt.key, 2, WithNx()); got != tt.want {
+				t.Errorf("Set() = %v, want %v", got, tt.want)
+			}
+			if got, _ := c.Get(tt.key); got != tt.wantV {
+				t.Errorf("Get() = %v, want %v", got, tt.wantV)
+			}
+		})
+	}
+}
+
+func TestWithNx_Concurrent(t *testing.T) {
+	c := NewMemCache()
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var winners []int
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if c.Set("k", i, WithNx()) {
+				lock.Lock()
+				winners = append(winners, i)
+				lock.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(winners) != 1 {
+		t.Fatalf("Set() succeeded %v times, want %v", len(winners), 1)
+	}
+	if got, _ := c.Get("k"); got != winners[0] {
+		t.Errorf("Get() = %v, want %v", got, winners[0])
+	}
+}
+
+func TestWithXx(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		want   bool
+		wantV  interface{}
+		wantOk bool
+	}{
+		{name: "exists", key: "int", want: true, wantV: 2, wantOk: true},
+		{name: "expired", key: "ex", want: false, wantV: nil, wantOk: false},
+		{name: "null", key: "null", want: false, wantV: nil, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mockCache()
+			c.Set("ex", 1, WithEx(time.Nanosecond))
+			if got := c.Set(tt.key, 2, WithXx()); got != tt.want {
+				t.Errorf("Set() = %v, want %v", got, tt.want)
+			}
+			got, ok := c.Get(tt.key)
+			if got != tt.wantV || ok != tt.wantOk {
+				t.Errorf("Get() = %v, %v, want %v, %v", got, ok, tt.wantV, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestWithKeepTTL(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "ttl", key: "ex", want: 1 * time.Second, wantOk: true},
+		{name: "no ttl", key: "int", want: 0, wantOk: false},
+		{name: "null", key: "null", want: 0, wantOk: false},
+	}
+	c := mockCache()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.Set(tt.key, 2, WithKeepTTL())
+			if got, _ := c.Get(tt.key); got != 2 {
+				t.Errorf("Get() = %v, want %v", got, 2)
+			}
+			got, ok := c.Ttl(tt.key)
+			if tt.want-got > 10*time.Millisecond || ok != tt.wantOk {
+				t.Errorf("Ttl() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestWithLoader(t *testing.T) {
+	loader := &mapLoader{values: map[string]interface{}{"a": "A"}, ttl: time.Minute}
+	c := NewMemCache(WithLoader(loader))
+	if c.Exists("a") {
+		t.Errorf("Exists() = %v, want %v", true, false)
+	}
+	for i := 0; i < 3; i++ {
+		if got, ok := c.Get("a"); got != "A" || !ok {
+			t.Errorf("Get() = %v, %v, want %v, %v", got, ok, "A", true)
+		}
+	}
+	if got := atomic.LoadInt32(&loader.calls); got != 1 {
+		t.Errorf("Load() called %v times, want %v", got, 1)
+	}
+	if ttl, ok := c.Ttl("a"); !ok || time.Minute-ttl > 10*time.Millisecond {
+		t.Errorf("Ttl() = %v, %v, want %v, %v", ttl, ok, time.Minute, true)
+	}
+	if got, ok := c.Get("b"); got != nil || ok {
+		t.Errorf("Get() = %v, %v, want %v, %v", got, ok, nil, false)
+	}
+	if c.Exists("b") {
+		t.Errorf("Exists() = %v, want %v", true, false)
+	}
+}
+
+func TestWithWriteThrough(t *testing.T) {
+	errStore := errors.New("store")
+	tests := []struct {
+		name      string
+		err       error
+		do        func(c ICache) bool
+		want      bool
+		wantCache map[string]interface{}
+		wantStore map[string]interface{}
+	}{
+		{name: "Set", do: func(c ICache) bool { return c.Set("a", 2) }, want: true,
+			wantCache: map[string]interface{}{"a": 2, "b": 1}, wantStore: map[string]interface{}{"a": 2, "b": 1}},
+		{name: "Set error", err: errStore, do: func(c ICache) bool { return c.Set("a", 2) }, want: false,
+			wantCache: map[string]interface{}{"a": 1, "b": 1}, wantStore: map[string]interface{}{"a": 1, "b": 1}},
+		{name: "Set Nx", do: func(c ICache) bool { return c.Set("a", 2, WithNx()) }, want: false,
+			wantCache: map[string]interface{}{"a": 1, "b": 1}, wantStore: map[string]interface{}{"a": 1, "b": 1}},
+		{name: "MSetNX", do: func(c ICache) bool { return c.MSetNX(map[string]interface{}{"c": 1, "d": 1}) }, want: true,
+			wantCache: map[string]interface{}{"a": 1, "b": 1, "c": 1, "d": 1}, wantStore: map[string]interface{}{"a": 1, "b": 1, "c": 1, "d": 1}},
+		{name: "MSetNX error", err: errStore, do: func(c ICache) bool { return c.MSetNX(map[string]interface{}{"c": 1, "d": 1}) }, want: false,
+			wantCache: map[string]interface{}{"a": 1, "b": 1}, wantStore: map[string]interface{}{"a": 1, "b": 1}},
+		{name: "Del", do: func(c ICache) bool { return c.Del("a", "c") == 1 }, want: true,
+			wantCache: map[string]interface{}{"b": 1}, wantStore: map[string]interface{}{"b": 1}},
+		{name: "Del error", err: errStore, do: func(c ICache) bool { return c.Del("a") == 1 }, want: false,
+			wantCache: map[string]interface{}{"a": 1, "b": 1}, wantStore: map[string]interface{}{"a": 1, "b": 1}},
+		{name: "GetDel", do: func(c ICache) bool { _, ok := c.GetDel("a"); return ok }, want: true,
+			wantCache: map[string]interface{}{"b": 1}, wantStore: map[string]interface{}{"b": 1}},
+		{name: "IncrBy", do: func(c ICache) bool { _, err := c.IncrBy("a", 1); return err == nil }, want: true,
+			wantCache: map[string]interface{}{"a": 2, "b": 1}, wantStore: map[string]interface{}{"a": 2, "b": 1}},
+		{name: "IncrBy error", err: errStore, do: func(c ICache) bool { _, err := c.IncrBy("a", 1); return err == nil }, want: false,
+			wantCache: map[string]interface{}{"a": 1, "b": 1}, wantStore: map[string]interface{}{"a": 1, "b": 1}},
+		{name: "Compute delete", do: func(c ICache) bool {
+			_, ok := c.Compute("a", func(interface{}, bool) (interface{}, bool) { return nil, false })
+			return ok
+		}, want: false, wantCache: map[string]interface{}{"b": 1}, wantStore: map[string]interface{}{"b": 1}},
+		{name: "Flush", do: func(c ICache) bool { c.Flush(); return true }, want: true,
+			wantCache: map[string]interface{}{}, wantStore: map[string]interface{}{"a": 1, "b": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			c := NewMemCache(WithWriteThrough(store))
+			c.Set("a", 1)
+			c.Set("b", 1)
+			store.fail(tt.err)
+			if got := tt.do(c); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if got := c.ToMap(); !reflect.DeepEqual(got, tt.wantCache) {
+				t.Errorf("ToMap() = %v, want %v", got, tt.wantCache)
+			}
+			if got, _ := store.snapshot(); !reflect.DeepEqual(got, tt.wantStore) {
+				t.Errorf("store = %v, want %v", got, tt.wantStore)
+			}
+		})
+	}
+}
+
+func TestWithWriteThrough_Loader(t *testing.T) {
+	store := newFakeStore()
+	c := NewMemCache(WithWriteThrough(store), WithLoader(&mapLoader{values: map[string]interface{}{"a": 1}}))
+	if got, ok := c.Get("a"); got != 1 || !ok {
+		t.Errorf("Get() = %v, %v, want %v, %v", got, ok, 1, true)
+	}
+	if got, _ := store.snapshot(); len(got) != 0 {
+		t.Errorf("store = %v, want the loaded values not written back", got)
+	}
+}
+
+func TestWithStoreErrorHandler(t *testing.T) {
+	errStore := errors.New("store")
+	store := newFakeStore()
+	store.fail(errStore)
+	var got []StoreWrite
+	var gotErr error
+	c := NewMemCache(WithWriteBehind(store, time.Hour, 100), WithStoreErrorHandler(func(batch []StoreWrite, err error) {
+		got, gotErr = batch, err
+	}))
+	c.Set("a", 1)
+	c.Close()
+	if want := []StoreWrite{{Key: "a", Value: 1}}; !reflect.DeepEqual(got, want) || gotErr != errStore {
+		t.Errorf("StoreErrorHandler() = %v, %v, want %v, %v", got, gotErr, want, errStore)
+	}
+}
+
+func TestWithRefreshAhead(t *testing.T) {
+	var calls int32
+	release := make(chan struct{}, 10)
+	loader := loaderFunc(func(ctx context.Context, k string) (interface{}, time.Duration, error) {
+		n := atomic.AddInt32(&calls, 1)
+		if n > 1 {
+			<-release
+		}
+		return int(n), 100 * time.Millisecond, nil
+	})
+	c := NewMemCache(WithLoader(loader), WithRefreshAhead(0.5))
+	if got, _ := c.Get("a"); got != 1 {
+		t.Errorf("Get() = %v, want %v", got, 1)
+	}
+	time.Sleep(20 * time.Millisecond)
+	c.Get("a")
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("loader called %v times before the refresh time, want %v", got, 1)
+	}
+	time.Sleep(40 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		if got, _ := c.Get("a"); got != 1 {
+			t.Errorf("Get() = %v while refreshing, want %v", got, 1)
+		}
+	}
+	release <- struct{}{}
+	time.Sleep(10 * time.Millisecond)
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("loader called %v times, want %v", got, 2)
+	}
+	if got, _ := c.Get("a"); got != 2 {
+		t.Errorf("Get() = %v after the refresh, want %v", got, 2)
+	}
+	if ttl, _ := c.Ttl("a"); ttl < 80*time.Millisecond {
+		t.Errorf("Ttl() = %v after the refresh, want about %v", ttl, 100*time.Millisecond)
+	}
+
+	// a value set while refreshing wins over the reloaded one
+	time.Sleep(60 * time.Millisecond)
+	c.Get("a")
+	c.Set("a", "new", WithEx(time.Minute))
+	release <- struct{}{}
+	time.Sleep(10 * time.Millisecond)
+	if got, _ := c.Get("a"); got != "new" {
+		t.Errorf("Get() = %v, want %v", got, "new")
+	}
+}
+
+func TestWithSoftEx(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []SetIOption
+		wantSoft   time.Duration
+		wantExpire time.Duration
+	}{
+		{name: "soft", opts: []SetIOption{WithSoftEx(time.Second)}, wantSoft: time.Second, wantExpire: time.Second},
+		{name: "soft, stale", opts: []SetIOption{WithSoftEx(time.Second), WithStaleFor(time.Minute)},
+			wantSoft: time.Second, wantExpire: time.Second + time.Minute},
+		{name: "stale, soft", opts: []SetIOption{WithStaleFor(time.Minute), WithSoftEx(time.Second)},
+			wantSoft: time.Second, wantExpire: time.Second + time.Minute},
+		{name: "ex, stale", opts: []SetIOption{WithEx(time.Second), WithStaleFor(time.Minute)},
+			wantSoft: time.Second, wantExpire: time.Second + time.Minute},
+		{name: "stale, ex", opts: []SetIOption{WithStaleFor(time.Minute), WithEx(time.Second)},
+			wantSoft: time.Second, wantExpire: time.Second + time.Minute},
+		{name: "soft, ex", opts: []SetIOption{WithSoftEx(time.Second), WithEx(time.Minute)},
+			wantSoft: time.Second, wantExpire: time.Minute},
+		{name: "ex, soft", opts: []SetIOption{WithEx(time.Minute), WithSoftEx(time.Second)},
+			wantSoft: time.Second, wantExpire: time.Minute},
+		{name: "soft, shorter ex", opts: []SetIOption{WithSoftEx(time.Minute), WithEx(time.Second)},
+			wantSoft: time.Minute, wantExpire: time.Minute},
+		{name: "shorter ex, soft", opts: []SetIOption{WithEx(time.Second), WithSoftEx(time.Minute)},
+			wantSoft: time.Minute, wantExpire: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			item := &setting{Item: Item{v: 1}}
+			for _, opt := range tt.opts {
+				opt(nil, "k", item)
+			}
+			if got := item.ext().soft.Sub(now); got < tt.wantSoft || got-tt.wantSoft > 10*time.Millisecond {
+				t.Errorf("soft = %v, want %v", got, tt.wantSoft)
+			}
+			if got := item.expire.Sub(now); got < tt.wantExpire || got-tt.wantExpire > 10*time.Millisecond {
+				t.Errorf("expire = %v, want %v", got, tt.wantExpire)
+			}
+		})
+	}
+}
+
+func TestWithSoftEx_Order(t *testing.T) {
+	tests := []struct {
+		name string
+		soft time.Duration
+		ex   time.Duration
+		want time.Duration
+	}{
+		{name: "shorter ex", soft: time.Minute, ex: time.Second, want: time.Minute},
+		{name: "longer ex", soft: time.Second, ex: time.Minute, want: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemCache()
+			c.Set("soft first", 1, WithSoftEx(tt.soft), WithEx(tt.ex))
+			c.Set("ex first", 1, WithEx(tt.ex), WithSoftEx(tt.soft))
+			for _, k := range []string{"soft first", "ex first"} {
+				if got, _ := c.Ttl(k); got > tt.want || tt.want-got > 10*time.Millisecond {
+					t.Errorf("Ttl(%v) = %v, want %v", k, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestWithStaleFor(t *testing.T) {
+	var calls int32
+	var fail int32
+	loaded := make(chan struct{}, 10)
+	loader := loaderFunc(func(ctx context.Context, k string) (interface{}, time.Duration, error) {
+		defer func() { loaded <- struct{}{} }()
+		n := atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&fail) == 1 {
+			return nil, 0, errors.New("down")
+		}
+		return int(n), 50 * time.Millisecond, nil
+	})
+	c := NewMemCache(WithLoader(loader))
+	c.Set("a", 0, WithSoftEx(50*time.Millisecond), WithStaleFor(100*time.Millisecond))
+	if v, stale, ok := c.GetWithStale("a"); v != 0 || stale || !ok {
+		t.Errorf("GetWithStale() = %v, %v, %v, want %v, %v, %v", v, stale, ok, 0, false, true)
+	}
+
+	// stale while revalidate
+	time.Sleep(60 * time.Millisecond)
+	if v, stale, ok := c.GetWithStale("a"); v != 0 || !stale || !ok {
+		t.Errorf("GetWithStale() = %v, %v, %v, want %v, %v, %v", v, stale, ok, 0, true, true)
+	}
+	<-loaded
+	time.Sleep(5 * time.Millisecond)
+	if v, stale, ok := c.GetWithStale("a"); v != 1 || stale || !ok {
+		t.Errorf("GetWithStale() = %v, %v, %v, want %v, %v, %v", v, stale, ok, 1, false, true)
+	}
+
+	// stale if error, until the expire time
+	atomic.StoreInt32(&fail, 1)
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if v, err := c.GetE("a"); v != 1 || err != nil {
+			t.Errorf("GetE() = %v, %v, want %v, %v", v, err, 1, nil)
+		}
+		<-loaded
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if v, err := c.GetE("a"); v != nil || err == nil {
+		t.Errorf("GetE() = %v, %v after the expire time, want %v, an error", v, err, nil)
+	}
+}
+
+func TestWithNegativeTTL(t *testing.T) {
+	loader := &mapLoader{values: map[string]interface{}{"a": "A"}}
+	c := NewMemCache(WithLoader(loader), WithNegativeTTL(50*time.Millisecond))
+	for i := 0; i < 3; i++ {
+		if got, err := c.GetE("b"); got != nil || err != ErrNotFound {
+			t.Errorf("GetE() = %v, %v, want %v, %v", got, err, nil, ErrNotFound)
+		}
+	}
+	if got := atomic.LoadInt32(&loader.calls); got != 1 {
+		t.Errorf("Load() called %v times, want %v", got, 1)
+	}
+	if got, ok := c.Get("b"); got != nil || ok {
+		t.Errorf("Get() = %v, %v, want %v, %v", got, ok, nil, false)
+	}
+	if _, _, ok := c.GetWithVersion("b"); ok {
+		t.Errorf("GetWithVersion() found a tombstone")
+	}
+	if c.Exists("b") {
+		t.Errorf("Exists() = %v, want %v", true, false)
+	}
+	if _, ok := c.Ttl("b"); ok {
+		t.Errorf("Ttl() found a tombstone")
+	}
+	c.Get("a")
+	if got, want := c.ToMap(), map[string]interface{}{"a": "A"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ToMap() = %v, want %v", got, want)
+	}
+	if got, want := c.MGet("a", "b"), map[string]interface{}{"a": "A"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("MGet() = %v, want %v", got, want)
+	}
+	if got := atomic.LoadInt32(&loader.calls); got != 2 {
+		t.Errorf("Load() called %v times, want %v", got, 2)
+	}
+
+	// the tombstone does not exist for writes either
+	if c.Set("b", 1, WithXx()) {
+		t.Errorf("Set() WithXx = %v, want %v", true, false)
+	}
+	if got, _ := c.IncrBy("b", 1); got != 1 {
+		t.Errorf("IncrBy() = %v, want %v", got, 1)
+	}
+	c.Del("b")
+
+	time.Sleep(60 * time.Millisecond)
+	c.Get("b")
+	if got := atomic.LoadInt32(&loader.calls); got != 3 {
+		t.Errorf("Load() called %v times after the negative ttl, want %v", got, 3)
+	}
+}
+
+func TestWithNegativeTTL_SetDuringLoad(t *testing.T) {
+	loading, release := make(chan struct{}), make(chan struct{})
+	loader := loaderFunc(func(ctx context.Context, k string) (interface{}, time.Duration, error) {
+		close(loading)
+		<-release
+		return nil, 0, ErrNotFound
+	})
+	c := NewMemCache(WithLoader(loader), WithNegativeTTL(time.Minute))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.GetE("k")
+	}()
+	<-loading
+	c.Set("k", "fresh")
+	close(release)
+	<-done
+	if got, ok := c.Get("k"); got != "fresh" || !ok {
+		t.Errorf("Get() = %v, %v, want the value set during the load %v, %v", got, ok, "fresh", true)
+	}
+}
+
+func TestWithNegativeTTL_BulkLoader(t *testing.T) {
+	loader := &mapBulkLoader{mapLoader: mapLoader{values: map[string]interface{}{"a": "A"}}}
+	c := NewMemCache(WithLoader(loader), WithNegativeTTL(time.Minute))
+	c.MGet("a", "b")
+	c.MGet("a", "b")
+	if want := [][]string{{"a", "b"}}; !reflect.DeepEqual(loader.keys, want) {
+		t.Errorf("LoadAll() keys = %v, want %v", loader.keys, want)
+	}
+}
+
+func TestWithNegativeTTL_Callbacks(t *testing.T) {
+	var reasons []RemovalReason
+	c := NewMemCache(WithLoader(&mapLoader{}), WithNegativeTTL(time.Minute),
+		WithRemovalListener(func(k string, v interface{}, reason RemovalReason) error {
+			reasons = append(reasons, reason)
+			return nil
+		}))
+	c.Get("a")
+	c.Set("a", 1)
+	c.Del("a")
+	c.Get("b")
+	c.Flush()
+	if want := []RemovalReason{Deleted}; !reflect.DeepEqual(reasons, want) {
+		t.Errorf("RemovalListener() reasons = %v, want %v", reasons, want)
+	}
+}
+
+func TestWithSlidingEx(t *testing.T) {
+	expired := make(chan string, 1)
+	c := NewMemCache(WithClearInterval(10*time.Millisecond), WithExpiredCallback(func(k string, v interface{}) error {
+		expired <- k
+		return nil
+	}))
+	c.Set("a", 1, WithSlidingEx(50*time.Millisecond))
+	for i := 0; i < 5; i++ {
+		time.Sleep(30 * time.Millisecond)
+		if got, ok := c.Get("a"); got != 1 || !ok {
+			t.Fatalf("Get() = %v, %v after %v reads, want %v, %v", got, ok, i, 1, true)
+		}
+		if ttl, ok := c.Ttl("a"); !ok || 50*time.Millisecond-ttl > 5*time.Millisecond {
+			t.Errorf("Ttl() = %v, %v, want %v, %v", ttl, ok, 50*time.Millisecond, true)
+		}
+	}
+	select {
+	case k := <-expired:
+		t.Errorf("%v expired while read", k)
+	default:
+	}
+	select {
+	case <-expired:
+	case <-time.After(100 * time.Millisecond):
+		t.Errorf("ExpiredCallback not called once idle")
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Get() found an idle key")
+	}
+
+	// another expire time replaces the sliding one
+	c.Set("b", 1, WithSlidingEx(50*time.Millisecond), WithEx(time.Minute))
+	c.Set("c", 1, WithEx(time.Minute), WithSlidingEx(50*time.Millisecond))
+	time.Sleep(60 * time.Millisecond)
+	if !c.Exists("b") || c.Exists("c") {
+		t.Errorf("Exists() = %v, %v, want %v, %v", c.Exists("b"), c.Exists("c"), true, false)
+	}
+}
+
+func TestWithJitter(t *testing.T) {
+	const keys = 100
+	deadline := time.Now().Add(time.Hour)
+	tests := []struct {
+		name    string
+		copts   []ICacheOption
+		opts    []SetIOption
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{name: "none", opts: []SetIOption{WithExAt(deadline)}, wantMin: time.Hour, wantMax: time.Hour},
+		{name: "jitter", opts: []SetIOption{WithExAt(deadline), WithJitter(0.5)}, wantMin: 30 * time.Minute, wantMax: time.Hour},
+		{name: "jitter first", opts: []SetIOption{WithJitter(0.5), WithExAt(deadline)}, wantMin: 30 * time.Minute, wantMax: time.Hour},
+		{name: "default", copts: []ICacheOption{WithDefaultJitter(0.1)}, opts: []SetIOption{WithExAt(deadline)},
+			wantMin: 54 * time.Minute, wantMax: time.Hour},
+		{name: "override default", copts: []ICacheOption{WithDefaultJitter(0.1)}, opts: []SetIOption{WithExAt(deadline), WithJitter(0)},
+			wantMin: time.Hour, wantMax: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemCache(tt.copts...)
+			distinct := map[time.Duration]bool{}
+			for i := 0; i < keys; i++ {
+				k := string(rune('a' + i))
+				c.Set(k, i, tt.opts...)
+				ttl, _ := c.Ttl(k)
+				if ttl < tt.wantMin-time.Second || ttl > tt.wantMax {
+					t.Fatalf("Ttl() = %v, want between %v and %v", ttl, tt.wantMin, tt.wantMax)
+				}
+				distinct[ttl.Round(time.Second)] = true
+			}
+			if tt.wantMin != tt.wantMax && len(distinct) < keys/2 {
+				t.Errorf("got %v distinct ttl for %v keys", len(distinct), keys)
+			}
+		})
+	}
+}
+
+func TestWithJitterSeed(t *testing.T) {
+	deadline := time.Now().Add(time.Hour)
+	expires := func(seed int64) []time.Time {
+		c := NewMemCache(WithShards(1), WithJitterSeed(seed), WithDefaultJitter(0.5)).(*MemCache)
+		var got []time.Time
+		for i := 0; i < 10; i++ {
+			k := string(rune('a' + i))
+			c.Set(k, i, WithExAt(deadline))
+			expire := c.shards[0].hashmap[k].expire
+			c.Set(k, i+1, WithKeepTTL())
+			if kept := c.shards[0].hashmap[k].expire; !kept.Equal(expire) {
+				t.Errorf("WithKeepTTL() expire = %v, want %v", kept, expire)
+			}
+			got = append(got, expire.Round(time.Second))
+		}
+		return got
+	}
+	if a, b := expires(1), expires(1); !reflect.DeepEqual(a, b) {
+		t.Errorf("expire times with the same seed = %v and %v", a, b)
+	}
+	if a, b := expires(1), expires(2); reflect.DeepEqual(a, b) {
+		t.Errorf("expire times with different seeds are the same: %v", a)
+	}
+}
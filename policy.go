@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"container/list"
+	"math/rand"
+	"time"
+)
+
+// EvictionPolicyOf tracks the keys of a shard and chooses the victim when the shard is over its budget.
+// Each shard owns its own EvictionPolicyOf and serializes the calls to it, so implementations need no locking.
+// Calls are made while the shard is locked, so an EvictionPolicyOf must not call back into the cache.
+type EvictionPolicyOf[K comparable] interface {
+	// OnAccess is called when an existing key is read or overwritten.
+	OnAccess(k K)
+	// OnInsert is called when a new key is stored.
+	OnInsert(k K)
+	// OnDelete is called when a key is removed, whether it was deleted, expired or evicted.
+	OnDelete(k K)
+	// Victim returns the key to evict, false if no key is tracked.
+	// The cache removes the victim and calls OnDelete right after.
+	Victim() (K, bool)
+}
+
+// EvictionPolicy is the EvictionPolicyOf the string keys of an ICache.
+type EvictionPolicy = EvictionPolicyOf[string]
+
+// Policy is the algorithm used by a bounded cache to choose which key to evict
+type Policy int
+
+const (
+	// PolicyLRU evicts the least recently used key.
+	PolicyLRU Policy = iota
+	// PolicyTinyLFU evicts with Window-TinyLFU, which keeps frequently used keys when one-off keys are scanned.
+	PolicyTinyLFU
+	// PolicyLFU evicts the least frequently used key.
+	PolicyLFU
+	// PolicyFIFO evicts the oldest key, regardless of its use.
+	PolicyFIFO
+	// PolicyRandom evicts a random key.
+	PolicyRandom
+	// PolicyARC evicts with the Adaptive Replacement Cache algorithm, which balances recency and frequency.
+	PolicyARC
+)
+
+// newEvictionPolicy returns the built-in policy tracking one shard, hash is the Hasher of the keys of the cache.
+func newEvictionPolicy[K comparable](p Policy, capacity int, hash Hasher[K]) EvictionPolicyOf[K] {
+	switch p {
+	case PolicyTinyLFU:
+		return newTinyLFUPolicy[K](capacity, hash)
+	case PolicyLFU:
+		return newLFUPolicy[K](capacity)
+	case PolicyFIFO:
+		return newFIFOPolicy[K](capacity)
+	case PolicyRandom:
+		return newRandomPolicy[K](capacity)
+	case PolicyARC:
+		return newARCPolicy[K](capacity)
+	default:
+		return newLRUPolicy[K](capacity)
+	}
+}
+
+// lruPolicy keeps the keys in recency order, the most recently used key at the front.
+type lruPolicy[K comparable] struct {
+	ll    *list.List
+	elems map[K]*list.Element
+}
+
+// NewLRUPolicy returns an EvictionPolicy evicting the least recently used key.
+func NewLRUPolicy(capacity int) EvictionPolicy {
+	return newLRUPolicy[string](capacity)
+}
+
+func newLRUPolicy[K comparable](capacity int) *lruPolicy[K] {
+	return &lruPolicy[K]{ll: list.New(), elems: make(map[K]*list.Element, capacity)}
+}
+
+func (p *lruPolicy[K]) OnAccess(k K) {
+	if e, ok := p.elems[k]; ok {
+		p.ll.MoveToFront(e)
+	}
+}
+
+func (p *lruPolicy[K]) OnInsert(k K) {
+	if e, ok := p.elems[k]; ok {
+		p.ll.MoveToFront(e)
+		return
+	}
+	p.elems[k] = p.ll.PushFront(k)
+}
+
+func (p *lruPolicy[K]) OnDelete(k K) {
+	if e, ok := p.elems[k]; ok {
+		p.ll.Remove(e)
+		delete(p.elems, k)
+	}
+}
+
+func (p *lruPolicy[K]) Victim() (K, bool) {
+	e := p.ll.Back()
+	if e == nil {
+		var zero K
+		return zero, false
+	}
+	return e.Value.(K), true
+}
+
+// fifoPolicy keeps the keys in insertion order, the newest key at the front.
+type fifoPolicy[K comparable] struct {
+	lruPolicy[K]
+}
+
+// NewFIFOPolicy returns an EvictionPolicy evicting the oldest key, reads and overwrites do not refresh a key.
+func NewFIFOPolicy(capacity int) EvictionPolicy {
+	return newFIFOPolicy[string](capacity)
+}
+
+func newFIFOPolicy[K comparable](capacity int) *fifoPolicy[K] {
+	return &fifoPolicy[K]{*newLRUPolicy[K](capacity)}
+}
+
+func (p *fifoPolicy[K]) OnAccess(k K) {}
+
+func (p *fifoPolicy[K]) OnInsert(k K) {
+	if _, ok := p.elems[k]; !ok {
+		p.elems[k] = p.ll.PushFront(k)
+	}
+}
+
+// randomPolicy keeps the keys in a slice so that a random one is picked in constant time.
+type randomPolicy[K comparable] struct {
+	keys  []K
+	index map[K]int
+	rand  *rand.Rand
+}
+
+// NewRandomPolicy returns an EvictionPolicy evicting a random key.
+func NewRandomPolicy(capacity int) EvictionPolicy {
+	return newRandomPolicy[string](capacity)
+}
+
+func newRandomPolicy[K comparable](capacity int) *randomPolicy[K] {
+	return &randomPolicy[K]{
+		keys:  make([]K, 0, capacity),
+		index: make(map[K]int, capacity),
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (p *randomPolicy[K]) OnAccess(k K) {}
+
+func (p *randomPolicy[K]) OnInsert(k K) {
+	if _, ok := p.index[k]; ok {
+		return
+	}
+	p.index[k] = len(p.keys)
+	p.keys = append(p.keys, k)
+}
+
+func (p *randomPolicy[K]) OnDelete(k K) {
+	i, ok := p.index[k]
+	if !ok {
+		return
+	}
+	last := len(p.keys) - 1
+	p.keys[i] = p.keys[last]
+	p.index[p.keys[i]] = i
+	var zero K
+	p.keys[last] = zero
+	p.keys = p.keys[:last]
+	delete(p.index, k)
+}
+
+func (p *randomPolicy[K]) Victim() (K, bool) {
+	if len(p.keys) == 0 {
+		var zero K
+		return zero, false
+	}
+	return p.keys[p.rand.Intn(len(p.keys))], true
+}
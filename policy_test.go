@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEvictionPolicy_Victim(t *testing.T) {
+	// Every policy sees: insert a, b, c, then access a twice and b once.
+	do := func(p EvictionPolicy) {
+		p.OnInsert("a")
+		p.OnInsert("b")
+		p.OnInsert("c")
+		p.OnAccess("a")
+		p.OnAccess("a")
+		p.OnAccess("b")
+	}
+	tests := []struct {
+		name      string
+		newPolicy func(capacity int) EvictionPolicy
+		want      string
+	}{
+		{name: "lru", newPolicy: NewLRUPolicy, want: "c"},
+		{name: "lfu", newPolicy: NewLFUPolicy, want: "c"},
+		{name: "fifo", newPolicy: NewFIFOPolicy, want: "a"},
+		{name: "arc", newPolicy: NewARCPolicy, want: "c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.newPolicy(3)
+			do(p)
+			if got, _ := p.Victim(); got != tt.want {
+				t.Errorf("Victim() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// evictionOrder returns the keys in the order the policy evicts them.
+func evictionOrder(p EvictionPolicy) []string {
+	var order []string
+	for {
+		k, ok := p.Victim()
+		if !ok {
+			return order
+		}
+		p.OnDelete(k)
+		order = append(order, k)
+	}
+}
+
+func TestEvictionPolicy_OnDelete(t *testing.T) {
+	do := func(p EvictionPolicy) {
+		p.OnInsert("a")
+		p.OnInsert("b")
+		p.OnInsert("c")
+		p.OnInsert("d")
+		p.OnAccess("c")
+		p.OnDelete("b")
+	}
+	tests := []struct {
+		name      string
+		newPolicy func(capacity int) EvictionPolicy
+		want      []string
+	}{
+		{name: "lru", newPolicy: NewLRUPolicy, want: []string{"a", "d", "c"}},
+		{name: "lfu", newPolicy: NewLFUPolicy, want: []string{"a", "d", "c"}},
+		{name: "fifo", newPolicy: NewFIFOPolicy, want: []string{"a", "c", "d"}},
+		{name: "arc", newPolicy: NewARCPolicy, want: []string{"a", "d", "c"}},
+		{name: "tinylfu", newPolicy: NewTinyLFUPolicy, want: []string{"d", "a", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.newPolicy(0)
+			do(p)
+			if got := evictionOrder(p); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evictionOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRandomPolicy(t *testing.T) {
+	p := NewRandomPolicy(0)
+	p.OnInsert("a")
+	p.OnInsert("b")
+	p.OnInsert("c")
+	p.OnInsert("a")
+	p.OnDelete("b")
+	got := map[string]bool{}
+	for _, k := range evictionOrder(p) {
+		got[k] = true
+	}
+	if want := map[string]bool{"a": true, "c": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("evictionOrder() = %v, want %v", got, want)
+	}
+}
+
+func TestARCPolicy_Ghost(t *testing.T) {
+	p := NewARCPolicy(2)
+	p.OnInsert("a")
+	p.OnAccess("a")
+	p.OnInsert("b")
+	p.OnInsert("c")
+	// b is evicted from t1 and remembered in b1.
+	if k, _ := p.Victim(); k != "b" {
+		t.Errorf("Victim() = %v, want %v", k, "b")
+	}
+	p.OnDelete("b")
+	// Inserting b again is a ghost hit: it goes to t2 and grows the target size of t1.
+	p.OnInsert("b")
+	if got := p.(*arcPolicy[string]).p; got != 1 {
+		t.Errorf("p = %v, want %v", got, 1)
+	}
+	if got := evictionOrder(p); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("evictionOrder() = %v, want %v", got, []string{"a", "b", "c"})
+	}
+}
@@ -0,0 +1,45 @@
+package cache
+
+// RemovalReason tells why a key-value pair was removed from the cache
+type RemovalReason int
+
+const (
+	// Expired the key reached its expire time.
+	Expired RemovalReason = iota
+	// Evicted the key was chosen by the eviction policy because the cache exceeded its max entries or max cost.
+	Evicted
+	// Deleted the key was removed by Del or GetDel.
+	Deleted
+	// Replaced the value was overwritten by Set or GetSet.
+	Replaced
+	// Flushed the key was removed by Flush.
+	Flushed
+)
+
+func (r RemovalReason) String() string {
+	switch r {
+	case Expired:
+		return "Expired"
+	case Evicted:
+		return "Evicted"
+	case Deleted:
+		return "Deleted"
+	case Replaced:
+		return "Replaced"
+	case Flushed:
+		return "Flushed"
+	default:
+		return "Unknown"
+	}
+}
+
+// RemovalListener Callback the function when a key-value pair leaves the cache, whatever the reason.
+// Note that it is executed after the removal, without holding any lock of the cache.
+type RemovalListener func(k string, v interface{}, reason RemovalReason) error
+
+// removal is a removed key-value pair waiting to be passed to the RemovalListener.
+type removal[K comparable] struct {
+	k      K
+	item   Item
+	reason RemovalReason
+}
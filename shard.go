@@ -2,6 +2,7 @@ package cache
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -9,91 +10,668 @@ import (
 // Note that it is executed after expiration
 type ExpiredCallback func(k string, v interface{}) error
 
-type memCacheShard struct {
-	hashmap         map[string]Item
-	lock            sync.RWMutex
-	expiredCallback ExpiredCallback
+type memCacheShard[K comparable] struct {
+	hashmap   map[K]Item
+	lock      sync.RWMutex
+	callbacks *callbackDispatcher[K]
+
+	// maxEntries is the share of the entries budget owned by this shard, 0 means unlimited.
+	maxEntries int
+	// maxCost is the cost budget of the whole cache, an item exceeding it alone is not stored.
+	maxCost int64
+	sizer   Sizer
+	// policy chooses the keys to evict when the cache is bounded.
+	// Reads only hold the read lock, so policyLock serializes their updates to policy.
+	policy     EvictionPolicyOf[K]
+	policyLock sync.Mutex
+	// cost points to the total cost of the items held by all shards of the cache.
+	cost *int64
+	// version is the version of the last item stored in the shard.
+	version uint64
+	// store receives the writes and deletions of the keys, nil when the cache has no Store.
+	store storeWriter[K]
+	// refreshAhead is the fraction of the time to live of an item after which a read refreshes it, 0 means never.
+	refreshAhead float64
+	// jitter is the default fraction of the time to live randomly cut from an item, see WithDefaultJitter.
+	// random is the state of the random generator of the jitter, only used under the write lock.
+	jitter float64
+	random uint64
+	// slots is the scan order of the keys, a key keeps its slot until it is removed, see Scan.
+	// free is the slots of the removed keys, reused by the keys inserted next.
+	slots []scanSlot[K]
+	free  []int32
+	// setting is the IItem passed to the SetIOption of the writes, reused under the write lock so that it is not allocated.
+	setting setting
+}
+
+//scanSlot is a position in the scan order of a shard, used tells whether it holds a key.
+type scanSlot[K comparable] struct {
+	k    K
+	used bool
 }
 
-func newMemCacheShard(conf *Config) *memCacheShard {
-	return &memCacheShard{expiredCallback: conf.expiredCallback, hashmap: map[string]Item{}}
+func newMemCacheShard[K comparable](conf *Config, maxEntries int, cost *int64, callbacks *callbackDispatcher[K], store storeWriter[K], newPolicy func(capacity int) EvictionPolicyOf[K], seed uint64) *memCacheShard[K] {
+	c := &memCacheShard[K]{callbacks: callbacks, hashmap: map[K]Item{}, cost: cost, store: store}
+	c.jitter, c.random = conf.jitter, seed
+	c.maxCost, c.sizer = conf.maxCost, conf.sizer
+	if conf.loader != nil {
+		c.refreshAhead = conf.refreshAhead
+	}
+	c.maxEntries = maxEntries
+	if conf.maxEntries > 0 || conf.maxCost > 0 {
+		c.policy = newPolicy(c.maxEntries)
+	}
+	return c
 }
 
-func (c *memCacheShard) set(k string, item *Item) {
+//set stores the item if every option passes, and writes it to the store if persist is true.
+//The options are evaluated under the write lock, so that conditions such as WithNx are atomic.
+func (c *memCacheShard[K]) set(cache ICache, k K, item *Item, opts []SetIOption, persist bool) bool {
 	c.lock.Lock()
+	old, found := c.hashmap[k]
+	if !c.apply(cache, k, item, old, found, opts) || (persist && c.write(k, item.v) != nil) {
+		c.lock.Unlock()
+		return false
+	}
+	removals := c.put(k, item, old, found)
+	c.lock.Unlock()
+	c.notifyAll(removals)
+	return true
+}
+
+//apply evaluates the options of a write of item, old is the item currently stored if found.
+//The options of a cache whose keys are not strings get a nil cache and an empty key.
+//The caller must hold the write lock.
+func (c *memCacheShard[K]) apply(cache ICache, k K, item *Item, old Item, found bool, opts []SetIOption) bool {
+	if len(opts) > 0 {
+		s := &c.setting
+		*s = setting{Item: *item, prev: old, found: found}
+		pass := c.applyOptions(cache, k, s, opts)
+		*item = s.Item
+		*s = setting{}
+		if !pass {
+			return false
+		}
+	}
+	return c.maxCost == 0 || item.cost <= c.maxCost
+}
+
+//applyOptions evaluates the options on s, and cuts the jitter from the time to live if they all pass.
+//The caller must hold the write lock.
+func (c *memCacheShard[K]) applyOptions(cache ICache, k K, s *setting, opts []SetIOption) bool {
+	key, _ := any(k).(string)
+	for _, opt := range opts {
+		if pass := opt(cache, key, s); !pass {
+			return false
+		}
+	}
+	c.applyJitter(s)
+	return true
+}
+
+//applyJitter cuts a random part of the time to live of the item, up to the fraction given by WithJitter or WithDefaultJitter.
+//A time to live kept from the previous item is left untouched. The caller must hold the write lock.
+func (c *memCacheShard[K]) applyJitter(s *setting) {
+	fraction := c.jitter
+	if s.jitter != nil {
+		fraction = *s.jitter
+	}
+	item := &s.Item
+	if fraction <= 0 || !item.CanExpire() || item.ext().sliding > 0 || (s.exists() && s.prev.expire.Equal(item.expire)) {
+		return
+	}
+	soft := item.ext().soft
+	deadline := item.expire
+	if !soft.IsZero() {
+		deadline = soft
+	}
+	ttl := deadline.Sub(time.Now())
+	if ttl <= 0 {
+		return
+	}
+	cut := time.Duration(float64(ttl) * fraction * c.float64())
+	item.expire = item.expire.Add(-cut)
+	if !soft.IsZero() {
+		item.extend().soft = soft.Add(-cut)
+	}
+}
+
+//float64 returns a pseudo-random number in [0,1) with splitmix64. The caller must hold the write lock.
+func (c *memCacheShard[K]) float64() float64 {
+	c.random += 0x9e3779b97f4a7c15
+	z := c.random
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return float64(z>>11) / (1 << 53)
+}
+
+//write writes the value of k to the store, if any. The caller must hold the write lock.
+func (c *memCacheShard[K]) write(k K, v interface{}) error {
+	if c.store == nil {
+		return nil
+	}
+	return c.store.write(k, v)
+}
+
+//unstore deletes k from the store, if any. The caller must hold the write lock.
+func (c *memCacheShard[K]) unstore(k K) error {
+	if c.store == nil {
+		return nil
+	}
+	return c.store.delete(k)
+}
+
+//put stores item in place of old, and evicts the keys exceeding maxEntries.
+//The caller must hold the write lock, and pass the returned removals to notifyAll once released.
+func (c *memCacheShard[K]) put(k K, item *Item, old Item, found bool) []removal[K] {
+	var removals []removal[K]
+	c.version++
+	item.version = c.version
+	if item.ext().refresh.IsZero() {
+		c.scheduleRefresh(item)
+	}
+	if found {
+		item.slot = old.slot
+	} else {
+		item.slot = c.takeSlot(k)
+	}
 	c.hashmap[k] = *item
+	if found && c.callbacks.active() {
+		removals = append(removals, removal[K]{k: k, item: old, reason: Replaced})
+	}
+	if item.cost != old.cost {
+		atomic.AddInt64(c.cost, item.cost-old.cost)
+	}
+	if c.policy != nil {
+		if found {
+			c.policy.OnAccess(k)
+		} else {
+			c.policy.OnInsert(k)
+		}
+		for c.maxEntries > 0 && len(c.hashmap) > c.maxEntries {
+			r, ok := c.evict()
+			if !ok {
+				break
+			}
+			if c.callbacks.active() {
+				removals = append(removals, r)
+			}
+		}
+	}
+	return removals
+}
+
+//scheduleRefresh sets the time after which a read refreshes item, once refreshAhead of its time to live has elapsed.
+func (c *memCacheShard[K]) scheduleRefresh(item *Item) {
+	var refresh time.Time
+	if c.refreshAhead > 0 && item.CanExpire() && !item.tombstone {
+		now := time.Now()
+		refresh = now.Add(time.Duration(float64(item.expire.Sub(now)) * c.refreshAhead))
+	}
+	if !refresh.Equal(item.ext().refresh) {
+		item.extend().refresh = refresh
+	}
+}
+
+//notifyAll passes the removals to the callbacks. It must be called without holding the lock.
+func (c *memCacheShard[K]) notifyAll(removals []removal[K]) {
+	for _, r := range removals {
+		c.notify(r.k, r.item, r.reason)
+	}
+}
+
+//notify passes the removal to the callbacks, an item which had expired is reported as Expired unless it was flushed.
+//It must be called without holding the lock.
+func (c *memCacheShard[K]) notify(k K, item Item, reason RemovalReason) {
+	if item.tombstone {
+		return
+	}
+	if reason != Flushed && item.Expired() {
+		reason = Expired
+	}
+	c.callbacks.dispatch(callbackTask[K]{k: k, v: item.v, reason: reason})
+}
+
+//expired passes the expired item to the callbacks, including the ExpiredCallback. It must be called without holding the lock.
+func (c *memCacheShard[K]) expired(k K, item Item) {
+	if item.tombstone {
+		return
+	}
+	c.callbacks.dispatch(callbackTask[K]{k: k, v: item.v, reason: Expired, expired: true})
+}
+
+//takeSlot returns a slot of the scan order for a new key, reusing the slot of a removed key if any.
+//The caller must hold the write lock.
+func (c *memCacheShard[K]) takeSlot(k K) int32 {
+	if n := len(c.free); n > 0 {
+		slot := c.free[n-1]
+		c.free = c.free[:n-1]
+		c.slots[slot] = scanSlot[K]{k: k, used: true}
+		return slot
+	}
+	c.slots = append(c.slots, scanSlot[K]{k: k, used: true})
+	return int32(len(c.slots) - 1)
+}
+
+//remove deletes the key and its bookkeeping. The caller must hold the write lock.
+func (c *memCacheShard[K]) remove(k K, item Item) {
+	delete(c.hashmap, k)
+	c.slots[item.slot] = scanSlot[K]{}
+	c.free = append(c.free, item.slot)
+	if c.policy != nil {
+		c.policy.OnDelete(k)
+	}
+	if item.cost != 0 {
+		atomic.AddInt64(c.cost, -item.cost)
+	}
+}
+
+//evict removes the victim chosen by the policy, returns false if there is nothing to remove,
+//or if the policy chose a key the shard does not hold, which is then deleted from the policy.
+//The caller must hold the write lock.
+func (c *memCacheShard[K]) evict() (removal[K], bool) {
+	k, ok := c.policy.Victim()
+	if !ok {
+		return removal[K]{}, false
+	}
+	item, found := c.hashmap[k]
+	if !found {
+		c.policy.OnDelete(k)
+		return removal[K]{}, false
+	}
+	c.remove(k, item)
+	return removal[K]{k: k, item: item, reason: Evicted}, true
+}
+
+//evictOne locks the shard and removes the victim chosen by the policy.
+func (c *memCacheShard[K]) evictOne() bool {
+	c.lock.Lock()
+	r, ok := c.evict()
 	c.lock.Unlock()
-	return
+	if ok {
+		c.notify(r.k, r.item, r.reason)
+	}
+	return ok
 }
 
-func (c *memCacheShard) get(k string) (interface{}, bool) {
+func (c *memCacheShard[K]) get(k K) (interface{}, bool) {
+	item, exist := c.getItem(k)
+	if item.tombstone {
+		return nil, false
+	}
+	return item.v, exist
+}
+
+//getItem returns the item of k, deleting it if it has expired. A tombstone is returned as found.
+//Reading the item restarts its sliding expiration.
+func (c *memCacheShard[K]) getItem(k K) (Item, bool) {
 	c.lock.RLock()
 	item, exist := c.hashmap[k]
+	expired := exist && item.Expired()
+	if exist && !expired {
+		item.touch()
+		if c.policy != nil {
+			c.policyLock.Lock()
+			c.policy.OnAccess(k)
+			c.policyLock.Unlock()
+		}
+	}
 	c.lock.RUnlock()
 	if !exist {
-		return nil, false
+		return Item{}, false
 	}
-	if !item.Expired() {
-		return item.v, true
+	if !expired {
+		return item, true
 	}
 	if c.delExpired(k) {
+		return Item{}, false
+	}
+	return c.getItem(k)
+}
+
+//getItems looks up the keys at the indexes idx like getItem, under a single read lock, and passes the item of keys[i]
+//to found(i, item), or i to missing if the key does not exist. A tombstone is passed to found.
+//found and missing are called under the read lock, except for the expired keys, so they must not call back into the shard.
+func (c *memCacheShard[K]) getItems(keys []K, idx []int, found func(i int, item Item), missing func(i int)) {
+	var expired []int
+	c.lock.RLock()
+	for _, i := range idx {
+		k := keys[i]
+		item, exist := c.hashmap[k]
+		if !exist {
+			missing(i)
+			continue
+		}
+		if item.Expired() {
+			expired = append(expired, i)
+			continue
+		}
+		item.touch()
+		if c.policy != nil {
+			c.policyLock.Lock()
+			c.policy.OnAccess(k)
+			c.policyLock.Unlock()
+		}
+		found(i, item)
+	}
+	c.lock.RUnlock()
+	for _, i := range expired {
+		if item, exist := c.getItem(keys[i]); exist {
+			found(i, item)
+		} else {
+			missing(i)
+		}
+	}
+}
+
+//setAll stores items[i] at keys[i] for the indexes idx under a single write lock, like set for each key,
+//and returns the number of keys stored.
+func (c *memCacheShard[K]) setAll(cache ICache, keys []K, items []Item, idx []int, opts []SetIOption) int {
+	var removals []removal[K]
+	var count int
+	c.lock.Lock()
+	for _, i := range idx {
+		k := keys[i]
+		old, found := c.hashmap[k]
+		if !c.apply(cache, k, &items[i], old, found, opts) || c.write(k, items[i].v) != nil {
+			continue
+		}
+		removals = append(removals, c.put(k, &items[i], old, found)...)
+		count++
+	}
+	c.lock.Unlock()
+	c.notifyAll(removals)
+	return count
+}
+
+//delAll removes the keys at the indexes idx under a single write lock, like del for each key,
+//and returns the number of keys removed.
+func (c *memCacheShard[K]) delAll(keys []K, idx []int) int {
+	var removals []removal[K]
+	var count int
+	c.lock.Lock()
+	for _, i := range idx {
+		k := keys[i]
+		if c.unstore(k) != nil {
+			continue
+		}
+		item, found := c.hashmap[k]
+		if !found {
+			continue
+		}
+		c.remove(k, item)
+		if item.live() {
+			count++
+		}
+		if c.callbacks.active() {
+			removals = append(removals, removal[K]{k: k, item: item, reason: Deleted})
+		}
+	}
+	c.lock.Unlock()
+	c.notifyAll(removals)
+	return count
+}
+
+//setAllNX stores items[i] at keys[i] held by shards[i], only if none of keys exists and every option passes for every key.
+//The caller must hold the write lock of every shard, and pass the returned removals to notifyAll of the shards once released.
+func setAllNX[K comparable](cache ICache, shards []*memCacheShard[K], keys []K, items []Item, opts []SetIOption) ([]removal[K], bool) {
+	olds := make([]Item, len(keys))
+	founds := make([]bool, len(keys))
+	for i, k := range keys {
+		olds[i], founds[i] = shards[i].hashmap[k]
+		if founds[i] && olds[i].live() {
+			return nil, false
+		}
+	}
+	for i, k := range keys {
+		if !shards[i].apply(cache, k, &items[i], olds[i], founds[i], opts) {
+			return nil, false
+		}
+	}
+	if len(keys) > 0 && shards[0].store != nil {
+		// A single batch, so that the store does not keep some of the keys when it fails.
+		batch := make([]StoreWriteOf[K, interface{}], len(keys))
+		for i, k := range keys {
+			batch[i] = StoreWriteOf[K, interface{}]{Key: k, Value: items[i].v}
+		}
+		if shards[0].store.writeAll(batch) != nil {
+			return nil, false
+		}
+	}
+	var removals []removal[K]
+	for i, k := range keys {
+		removals = append(removals, shards[i].put(k, &items[i], olds[i], founds[i])...)
+	}
+	return removals, true
+}
+
+//getSet stores the item if every option passes, and returns the value it replaced, atomically.
+func (c *memCacheShard[K]) getSet(cache ICache, k K, item *Item, opts []SetIOption) (interface{}, bool, bool) {
+	c.lock.Lock()
+	old, found := c.hashmap[k]
+	var v interface{}
+	exist := found && old.live()
+	if exist {
+		v = old.v
+	}
+	if !c.apply(cache, k, item, old, found, opts) || c.write(k, item.v) != nil {
+		c.lock.Unlock()
+		return v, exist, false
+	}
+	removals := c.put(k, item, old, found)
+	c.lock.Unlock()
+	c.notifyAll(removals)
+	return v, exist, true
+}
+
+//compareAndSwap stores the item if the version of k is still version, and every option passes.
+//Version 0 stands for a key which does not exist. The item is written to the store if persist is true.
+func (c *memCacheShard[K]) compareAndSwap(cache ICache, k K, version uint64, item *Item, opts []SetIOption, persist bool) bool {
+	c.lock.Lock()
+	old, found := c.hashmap[k]
+	if current(old, found) != version || !c.apply(cache, k, item, old, found, opts) || (persist && c.write(k, item.v) != nil) {
+		c.lock.Unlock()
+		return false
+	}
+	removals := c.put(k, item, old, found)
+	c.lock.Unlock()
+	c.notifyAll(removals)
+	return true
+}
+
+//compareAndDelete deletes k if its version is still version.
+func (c *memCacheShard[K]) compareAndDelete(k K, version uint64) bool {
+	c.lock.Lock()
+	item, found := c.hashmap[k]
+	if version == 0 || current(item, found) != version || c.unstore(k) != nil {
+		c.lock.Unlock()
+		return false
+	}
+	c.remove(k, item)
+	c.lock.Unlock()
+	c.notify(k, item, Deleted)
+	return true
+}
+
+//current returns the version of a stored item, 0 if it does not exist or has expired.
+func current(item Item, found bool) uint64 {
+	if !found || !item.live() {
+		return 0
+	}
+	return item.version
+}
+
+type computeMode int
+
+const (
+	computeAlways computeMode = iota
+	computeIfAbsent
+	computeIfPresent
+)
+
+//compute stores the value returned by f if it keeps it and every option passes, or deletes the key if it does not.
+//f is only called when the existence of the key matches mode. It returns the value at key afterwards.
+//f runs under the write lock, which is released even if f panics.
+func (c *memCacheShard[K]) compute(cache ICache, k K, mode computeMode, f func(old interface{}, exist bool) (interface{}, bool), opts []SetIOption) (interface{}, bool) {
+	var removals []removal[K]
+	c.lock.Lock()
+	defer func() {
+		c.lock.Unlock()
+		c.notifyAll(removals)
+	}()
+	old, found := c.hashmap[k]
+	exist := found && old.live()
+	var current interface{}
+	if exist {
+		current = old.v
+	}
+	if (mode == computeIfAbsent && exist) || (mode == computeIfPresent && !exist) {
+		return current, exist
+	}
+	v, keep := f(current, exist)
+	if !keep {
+		if exist && c.unstore(k) != nil {
+			return current, exist
+		}
+		if found {
+			c.remove(k, old)
+			removals = append(removals, removal[K]{k: k, item: old, reason: Deleted})
+		}
 		return nil, false
 	}
-	return c.get(k)
+	item := Item{v: v}
+	if c.maxCost > 0 {
+		item.cost = c.sizer.Size(v)
+	}
+	if !c.apply(cache, k, &item, old, found, opts) || c.write(k, v) != nil {
+		return current, exist
+	}
+	removals = c.put(k, &item, old, found)
+	return v, true
 }
 
-func (c *memCacheShard) getSet(k string, item *Item) (interface{}, bool) {
-	defer c.set(k, item)
-	return c.get(k)
+//update atomically replaces the value of k with the one returned by f, keeping its expire time.
+//exist is false when the key does not exist or has expired, the key is then created without timeout.
+//Nothing is stored when f returns an error.
+func (c *memCacheShard[K]) update(k K, f func(v interface{}, exist bool) (interface{}, error)) error {
+	c.lock.Lock()
+	old, found := c.hashmap[k]
+	exist := found && old.live()
+	var item Item
+	if exist {
+		item = old
+	}
+	v, err := f(item.v, exist)
+	if err != nil {
+		c.lock.Unlock()
+		return err
+	}
+	item.v = v
+	if !exist && c.maxCost > 0 {
+		item.cost = c.sizer.Size(v)
+	}
+	if err := c.write(k, v); err != nil {
+		c.lock.Unlock()
+		return err
+	}
+	removals := c.put(k, &item, old, found)
+	c.lock.Unlock()
+	c.notifyAll(removals)
+	return nil
 }
 
-func (c *memCacheShard) getDel(k string) (interface{}, bool) {
-	defer c.del(k)
-	return c.get(k)
+//getDel deletes the key and returns its value, atomically.
+func (c *memCacheShard[K]) getDel(k K) (interface{}, bool) {
+	c.lock.Lock()
+	if c.unstore(k) != nil {
+		c.lock.Unlock()
+		return nil, false
+	}
+	item, found := c.hashmap[k]
+	if !found {
+		c.lock.Unlock()
+		return nil, false
+	}
+	c.remove(k, item)
+	c.lock.Unlock()
+	if !item.live() {
+		c.expired(k, item)
+		return nil, false
+	}
+	c.notify(k, item, Deleted)
+	return item.v, true
 }
 
-func (c *memCacheShard) del(k string) int {
+func (c *memCacheShard[K]) del(k K) int {
 	var count int
 	c.lock.Lock()
+	if c.unstore(k) != nil {
+		c.lock.Unlock()
+		return 0
+	}
 	v, found := c.hashmap[k]
 	if found {
-		delete(c.hashmap, k)
-		if !v.Expired() {
+		c.remove(k, v)
+		if v.live() {
 			count++
 		}
 	}
 	c.lock.Unlock()
+	if found {
+		c.notify(k, v, Deleted)
+	}
 	return count
 }
 
 //delExpired Only delete when key expires
-func (c *memCacheShard) delExpired(k string) bool {
+func (c *memCacheShard[K]) delExpired(k K) bool {
 	c.lock.Lock()
 	item, found := c.hashmap[k]
 	if !found || !item.Expired() {
 		c.lock.Unlock()
 		return false
 	}
-	delete(c.hashmap, k)
+	c.remove(k, item)
 	c.lock.Unlock()
-	if c.expiredCallback != nil {
-		_ = c.expiredCallback(k, item.v)
+	c.expired(k, item)
+	return true
+}
+
+//expire sets the expire time of an existing key, leaving its value untouched.
+//A zero t removes the timeout, a t in the past deletes the key.
+func (c *memCacheShard[K]) expire(k K, t time.Time) bool {
+	c.lock.Lock()
+	item, found := c.hashmap[k]
+	if !found || !item.live() {
+		c.lock.Unlock()
+		return false
+	}
+	if !t.IsZero() && !t.After(time.Now()) {
+		c.remove(k, item)
+		c.lock.Unlock()
+		c.expired(k, item)
+		return true
 	}
+	item.expire, item.extra = t, nil
+	c.scheduleRefresh(&item)
+	c.hashmap[k] = item
+	c.lock.Unlock()
 	return true
 }
 
-func (c *memCacheShard) ttl(k string) (time.Duration, bool) {
+func (c *memCacheShard[K]) ttl(k K) (time.Duration, bool) {
 	c.lock.RLock()
 	v, found := c.hashmap[k]
 	c.lock.RUnlock()
-	if !found || !v.CanExpire() || v.Expired() {
+	if !found || !v.CanExpire() || !v.live() {
 		return 0, false
 	}
-	return v.expire.Sub(time.Now()), true
+	return v.deadline().Sub(time.Now()), true
 }
 
-func (c *memCacheShard) checkExpire() {
-	var expiredKeys []string
+func (c *memCacheShard[K]) checkExpire() {
+	var expiredKeys []K
 	c.lock.RLock()
 	for k, item := range c.hashmap {
 		if item.Expired() {
@@ -106,10 +684,76 @@ func (c *memCacheShard) checkExpire() {
 	}
 }
 
-func (c *memCacheShard) saveToMap(target map[string]interface{}) {
+func (c *memCacheShard[K]) flush() {
+	c.lock.Lock()
+	hashmap := c.hashmap
+	c.hashmap = map[K]Item{}
+	c.slots, c.free = nil, nil
+	for k, item := range hashmap {
+		if c.policy != nil {
+			c.policy.OnDelete(k)
+		}
+		if item.cost != 0 {
+			atomic.AddInt64(c.cost, -item.cost)
+		}
+	}
+	c.lock.Unlock()
+	for k, item := range hashmap {
+		c.notify(k, item, Flushed)
+	}
+}
+
+//len returns the number of live items, under the read lock.
+func (c *memCacheShard[K]) len() int {
+	var n int
+	c.lock.RLock()
+	for _, item := range c.hashmap {
+		if item.live() {
+			n++
+		}
+	}
+	c.lock.RUnlock()
+	return n
+}
+
+//keys appends the keys of the live items accepted by match to dst, under the read lock.
+func (c *memCacheShard[K]) keys(dst []K, match func(k K) bool) []K {
 	c.lock.RLock()
 	for k, item := range c.hashmap {
-		if item.Expired() {
+		if item.live() && match(k) {
+			dst = append(dst, k)
+		}
+	}
+	c.lock.RUnlock()
+	return dst
+}
+
+//scan appends the keys of the live items accepted by match to dst, in the scan order from slot pos,
+//until budget keys are visited. It returns the slot to resume from, and the number of keys visited.
+func (c *memCacheShard[K]) scan(dst []K, pos int, budget int, match func(k K) bool) ([]K, int, int) {
+	var visited int
+	c.lock.RLock()
+	for ; pos < len(c.slots) && visited < budget; pos++ {
+		s := c.slots[pos]
+		if !s.used {
+			continue
+		}
+		visited++
+		if item := c.hashmap[s.k]; item.live() && match(s.k) {
+			dst = append(dst, s.k)
+		}
+	}
+	if pos >= len(c.slots) {
+		pos = -1
+	}
+	c.lock.RUnlock()
+	return dst, pos, visited
+}
+
+func (c *memCacheShard[K]) saveToMap(target map[K]interface{}) {
+	c.lock.RLock()
+	for k, item := range c.hashmap {
+		if !item.live() {
 			continue
 		}
 		target[k] = item.v
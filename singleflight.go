@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LoaderFunc Load the value of a missing key, and the time to live it is cached with, 0 for no expiration
+type LoaderFunc func(ctx context.Context) (interface{}, time.Duration, error)
+
+// flight is a load in progress, shared by every caller missing the same key.
+type flight struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+	// waiters is the number of callers still waiting for the load.
+	waiters int
+	// background tells that the load was started by start, it is not canceled when its waiters give up.
+	background bool
+	v          interface{}
+	err        error
+}
+
+// flightGroup deduplicates the concurrent loads of a key, so that only one loader runs at a time.
+type flightGroup[K comparable] struct {
+	lock    sync.Mutex
+	flights map[K]*flight
+}
+
+// do runs load once for all the concurrent callers of k, and returns its result.
+// load runs in its own goroutine with a context which keeps the values of ctx, and is only canceled
+// once every caller has given up. Each caller returns early with ctx.Err() when its own ctx is done.
+func (g *flightGroup[K]) do(ctx context.Context, k K, load func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	g.lock.Lock()
+	if g.flights == nil {
+		g.flights = map[K]*flight{}
+	}
+	f, ok := g.flights[k]
+	if !ok {
+		loadCtx, cancel := context.WithCancel(detachedContext{ctx})
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.flights[k] = f
+		go g.run(loadCtx, k, f, load)
+	}
+	f.waiters++
+	g.lock.Unlock()
+
+	select {
+	case <-f.done:
+		return f.v, f.err
+	case <-ctx.Done():
+		g.lock.Lock()
+		f.waiters--
+		if f.waiters == 0 && !f.background {
+			f.cancel()
+			if g.flights[k] == f {
+				delete(g.flights, k)
+			}
+		}
+		g.lock.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// start runs load for k in the background, unless a load of k is already in progress.
+// Concurrent callers of do for k wait for it, like for any other load.
+func (g *flightGroup[K]) start(k K, load func(ctx context.Context) (interface{}, error)) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.flights == nil {
+		g.flights = map[K]*flight{}
+	}
+	if _, ok := g.flights[k]; ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &flight{done: make(chan struct{}), cancel: cancel, background: true}
+	g.flights[k] = f
+	go g.run(ctx, k, f, load)
+}
+
+func (g *flightGroup[K]) run(ctx context.Context, k K, f *flight, load func(ctx context.Context) (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			f.v, f.err = nil, fmt.Errorf("cache: loader of key %#v panicked: %v", k, r)
+		}
+		g.lock.Lock()
+		if g.flights[k] == f {
+			delete(g.flights, k)
+		}
+		g.lock.Unlock()
+		f.cancel()
+		close(f.done)
+	}()
+	f.v, f.err = load(ctx)
+}
+
+// detachedContext keeps the values of its parent, but neither its deadline nor its cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (c detachedContext) Done() <-chan struct{}             { return nil }
+func (c detachedContext) Err() error                        { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
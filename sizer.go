@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"reflect"
+)
+
+// Sizer is responsible for estimating the memory cost, in bytes, of a value stored in the cache.
+// Sizer should be fast, it is called on every Set when the cache is bounded by WithMaxCost.
+type Sizer interface {
+	Size(v interface{}) int64
+}
+
+// newDefaultSizer returns a Sizer which is exact for []byte and string values,
+// and falls back to walking the value with reflection for everything else.
+func newDefaultSizer() Sizer {
+	return reflectSizer{}
+}
+
+type reflectSizer struct{}
+
+// Size returns the length of []byte and string values, and an estimate of the bytes held by any other value.
+func (s reflectSizer) Size(v interface{}) int64 {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case []byte:
+		return int64(len(v))
+	case string:
+		return int64(len(v))
+	}
+	return sizeOf(reflect.ValueOf(v), map[sizeRef]struct{}{})
+}
+
+// sizeRef is a pointer, map or slice already walked by sizeOf, a slice is keyed together with its length.
+type sizeRef struct {
+	kind reflect.Kind
+	p    uintptr
+	n    int
+}
+
+// visit reports whether ref is walked for the first time, and marks it as seen.
+func visit(seen map[sizeRef]struct{}, ref sizeRef) bool {
+	if _, ok := seen[ref]; ok {
+		return false
+	}
+	seen[ref] = struct{}{}
+	return true
+}
+
+// sizeOf estimates the bytes held by v, following pointers, maps and slices once each, so that cycles end.
+func sizeOf(v reflect.Value, seen map[sizeRef]struct{}) int64 {
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && (v.IsNil() || !visit(seen, sizeRef{kind: reflect.Slice, p: v.Pointer(), n: v.Len()})) {
+			return 0
+		}
+		if isFlat(v.Type().Elem()) {
+			return int64(v.Len()) * int64(v.Type().Elem().Size())
+		}
+		var size int64
+		for i := 0; i < v.Len(); i++ {
+			size += sizeOf(v.Index(i), seen)
+		}
+		return size
+	case reflect.Map:
+		if v.IsNil() || !visit(seen, sizeRef{kind: reflect.Map, p: v.Pointer()}) {
+			return 0
+		}
+		var size int64
+		iter := v.MapRange()
+		for iter.Next() {
+			size += sizeOf(iter.Key(), seen) + sizeOf(iter.Value(), seen)
+		}
+		return size
+	case reflect.Ptr:
+		if v.IsNil() || !visit(seen, sizeRef{kind: reflect.Ptr, p: v.Pointer()}) {
+			return 0
+		}
+		return sizeOf(v.Elem(), seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return sizeOf(v.Elem(), seen)
+	case reflect.Struct:
+		if isFlat(v.Type()) {
+			return int64(v.Type().Size())
+		}
+		var size int64
+		for i := 0; i < v.NumField(); i++ {
+			size += sizeOf(v.Field(i), seen)
+		}
+		return size
+	default:
+		return int64(v.Type().Size())
+	}
+}
+
+// isFlat reports whether values of t hold no references, so their size is t.Size().
+func isFlat(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	case reflect.Array:
+		return isFlat(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !isFlat(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,51 @@
+package cache
+
+import "testing"
+
+func TestReflectSizer_Size(t *testing.T) {
+	type flat struct {
+		a int64
+		b int32
+	}
+	type nested struct {
+		s string
+		b []byte
+		p *flat
+	}
+	type node struct {
+		next *node
+		v    int64
+	}
+	cycle := &node{v: 1}
+	cycle.next = cycle
+	mapCycle := map[string]interface{}{}
+	mapCycle["self"] = mapCycle
+	sliceCycle := make([]interface{}, 1)
+	sliceCycle[0] = sliceCycle
+	tests := []struct {
+		name string
+		v    interface{}
+		want int64
+	}{
+		{name: "nil", v: nil, want: 0},
+		{name: "bytes", v: []byte("hello"), want: 5},
+		{name: "string", v: "hello", want: 5},
+		{name: "int64", v: int64(1), want: 8},
+		{name: "int32 slice", v: []int32{1, 2, 3}, want: 12},
+		{name: "string slice", v: []string{"a", "bc"}, want: 3},
+		{name: "map", v: map[string]int64{"a": 1, "bc": 2}, want: 19},
+		{name: "flat struct", v: flat{}, want: 16},
+		{name: "nested struct", v: nested{s: "abc", b: []byte("de"), p: &flat{}}, want: 21},
+		{name: "cycle", v: cycle, want: 8},
+		{name: "map cycle", v: mapCycle, want: 4},
+		{name: "slice cycle", v: sliceCycle, want: 0},
+	}
+	s := newDefaultSizer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.Size(tt.v); got != tt.want {
+				t.Errorf("Size() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
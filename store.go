@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// StoreOf is the persistent key-value store a cache is the front of, see WithWriteThrough and WithWriteBehind.
+// The values set and the keys deleted in the cache are written to the store,
+// evictions, expirations and Flush only affect the cache.
+type StoreOf[K comparable, V any] interface {
+	// Write the value of a key.
+	Write(ctx context.Context, k K, v V) error
+	// Delete a key, deleting a key which does not exist is not an error.
+	Delete(ctx context.Context, k K) error
+	// WriteBatch writes and deletes many keys at once, a key appears at most once in batch.
+	WriteBatch(ctx context.Context, batch []StoreWriteOf[K, V]) error
+}
+
+// Store is the StoreOf an ICache.
+type Store = StoreOf[string, interface{}]
+
+// StoreWriteOf is a pending write of a key to a StoreOf, or its deletion when Deleted is true.
+type StoreWriteOf[K comparable, V any] struct {
+	Key     K
+	Value   V
+	Deleted bool
+}
+
+// StoreWrite is a pending write of a key to a Store.
+type StoreWrite = StoreWriteOf[string, interface{}]
+
+// StoreErrorHandler Handle the error returned by the Store when a batch of WithWriteBehind is written.
+// The batch is not retried.
+type StoreErrorHandler func(batch []StoreWrite, err error)
+
+// anyStore adapts a StoreOf the values of a Cache to the interface{} values held by its shards.
+type anyStore[K comparable, V any] struct {
+	store StoreOf[K, V]
+}
+
+func (s anyStore[K, V]) Write(ctx context.Context, k K, v interface{}) error {
+	return s.store.Write(ctx, k, cast[V](v))
+}
+
+func (s anyStore[K, V]) Delete(ctx context.Context, k K) error {
+	return s.store.Delete(ctx, k)
+}
+
+func (s anyStore[K, V]) WriteBatch(ctx context.Context, batch []StoreWriteOf[K, interface{}]) error {
+	return s.store.WriteBatch(ctx, typedWrites[K, V](batch))
+}
+
+// toAnyStore returns store adapted to interface{} values.
+func toAnyStore[K comparable, V any](store StoreOf[K, V]) StoreOf[K, interface{}] {
+	if store == nil {
+		return nil
+	}
+	if s, ok := any(store).(StoreOf[K, interface{}]); ok {
+		return s
+	}
+	return anyStore[K, V]{store}
+}
+
+// typedWrites converts a batch of writes of interface{} values to the values of a Cache.
+func typedWrites[K comparable, V any](batch []StoreWriteOf[K, interface{}]) []StoreWriteOf[K, V] {
+	writes := make([]StoreWriteOf[K, V], len(batch))
+	for i, w := range batch {
+		writes[i] = StoreWriteOf[K, V]{Key: w.Key, Value: cast[V](w.Value), Deleted: w.Deleted}
+	}
+	return writes
+}
+
+// storeWriter propagates the writes and deletions of a cache to its Store.
+// It is called under the write lock of the shard holding the key, so that the store sees the writes of a key in order.
+type storeWriter[K comparable] interface {
+	write(k K, v interface{}) error
+	delete(k K) error
+	// writeAll writes the keys of batch at once, the caller holds the write locks of all their shards.
+	writeAll(batch []StoreWriteOf[K, interface{}]) error
+}
+
+// writeThrough writes to the store synchronously, a write of the cache fails if the store fails.
+type writeThrough[K comparable] struct {
+	store StoreOf[K, interface{}]
+}
+
+func (w writeThrough[K]) write(k K, v interface{}) error {
+	return w.store.Write(context.Background(), k, v)
+}
+
+func (w writeThrough[K]) delete(k K) error {
+	return w.store.Delete(context.Background(), k)
+}
+
+func (w writeThrough[K]) writeAll(batch []StoreWriteOf[K, interface{}]) error {
+	return w.store.WriteBatch(context.Background(), batch)
+}
+
+// writeBehind queues the writes and writes them to the store in batches,
+// keeping only the last write of each key.
+type writeBehind[K comparable] struct {
+	store        StoreOf[K, interface{}]
+	batchSize    int
+	errorHandler func(batch []StoreWriteOf[K, interface{}], err error)
+
+	lock    sync.Mutex
+	pending map[K]StoreWriteOf[K, interface{}]
+	// order is the order in which the pending keys were first written.
+	order []K
+	// full is signaled when the pending writes reach batchSize.
+	full chan struct{}
+	// done is closed once the pending writes are flushed after the cache is closed, err is the error of that last flush.
+	done chan struct{}
+	err  error
+}
+
+func newWriteBehind[K comparable](store StoreOf[K, interface{}], conf *Config, closed chan struct{}) *writeBehind[K] {
+	w := &writeBehind[K]{
+		store:        store,
+		batchSize:    conf.writeBehindBatch,
+		errorHandler: typed[func([]StoreWriteOf[K, interface{}], error)](conf.storeErrorHandler),
+		pending:      map[K]StoreWriteOf[K, interface{}]{},
+		full:         make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+	go w.run(conf.writeBehindInterval, closed)
+	return w
+}
+
+func (w *writeBehind[K]) write(k K, v interface{}) error {
+	w.enqueue(StoreWriteOf[K, interface{}]{Key: k, Value: v})
+	return nil
+}
+
+func (w *writeBehind[K]) delete(k K) error {
+	w.enqueue(StoreWriteOf[K, interface{}]{Key: k, Deleted: true})
+	return nil
+}
+
+func (w *writeBehind[K]) writeAll(batch []StoreWriteOf[K, interface{}]) error {
+	for _, sw := range batch {
+		w.enqueue(sw)
+	}
+	return nil
+}
+
+func (w *writeBehind[K]) enqueue(sw StoreWriteOf[K, interface{}]) {
+	w.lock.Lock()
+	if _, ok := w.pending[sw.Key]; !ok {
+		w.order = append(w.order, sw.Key)
+	}
+	w.pending[sw.Key] = sw
+	n := len(w.pending)
+	w.lock.Unlock()
+	if n >= w.batchSize {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run flushes the pending writes every interval or once they reach batchSize, until the cache is closed.
+func (w *writeBehind[K]) run(interval time.Duration, closed chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.flush()
+		case <-w.full:
+			w.flush()
+		case <-closed:
+			w.err = w.flush()
+			close(w.done)
+			return
+		}
+	}
+}
+
+// flush writes the pending writes to the store in batches of at most batchSize.
+func (w *writeBehind[K]) flush() error {
+	var last error
+	for {
+		batch := w.take()
+		if len(batch) == 0 {
+			return last
+		}
+		if err := w.store.WriteBatch(context.Background(), batch); err != nil {
+			last = err
+			if w.errorHandler != nil {
+				w.errorHandler(batch, err)
+			}
+		}
+	}
+}
+
+// take removes up to batchSize pending writes, oldest first.
+func (w *writeBehind[K]) take() []StoreWriteOf[K, interface{}] {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	n := minInt(len(w.order), w.batchSize)
+	batch := make([]StoreWriteOf[K, interface{}], 0, n)
+	for _, k := range w.order[:n] {
+		batch = append(batch, w.pending[k])
+		delete(w.pending, k)
+	}
+	w.order = w.order[n:]
+	if len(w.order) == 0 {
+		w.order = nil
+	}
+	return batch
+}
+
+// wait waits for the last flush after the cache is closed, and returns its error.
+func (w *writeBehind[K]) wait() error {
+	<-w.done
+	return w.err
+}
@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStore is an in-memory Store, failing with err when it is set.
+type fakeStore struct {
+	lock    sync.Mutex
+	values  map[string]interface{}
+	batches [][]StoreWrite
+	err     error
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{values: map[string]interface{}{}}
+}
+
+func (s *fakeStore) Write(ctx context.Context, k string, v interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.values[k] = v
+	return nil
+}
+
+func (s *fakeStore) Delete(ctx context.Context, k string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	delete(s.values, k)
+	return nil
+}
+
+func (s *fakeStore) WriteBatch(ctx context.Context, batch []StoreWrite) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.batches = append(s.batches, batch)
+	if s.err != nil {
+		return s.err
+	}
+	for _, w := range batch {
+		if w.Deleted {
+			delete(s.values, w.Key)
+		} else {
+			s.values[w.Key] = w.Value
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) fail(err error) {
+	s.lock.Lock()
+	s.err = err
+	s.lock.Unlock()
+}
+
+func (s *fakeStore) snapshot() (map[string]interface{}, [][]StoreWrite) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	values := make(map[string]interface{}, len(s.values))
+	for k, v := range s.values {
+		values[k] = v
+	}
+	return values, append([][]StoreWrite(nil), s.batches...)
+}
+
+func TestWriteBehind_Coalesce(t *testing.T) {
+	store := newFakeStore()
+	c := NewMemCache(WithWriteBehind(store, time.Hour, 100))
+	c.Set("a", 1)
+	c.Set("b", 1)
+	c.Set("a", 2)
+	c.Del("b")
+	c.IncrBy("c", 5)
+	if values, _ := store.snapshot(); len(values) != 0 {
+		t.Errorf("store = %v before Close, want empty", values)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close() = %v, want nil", err)
+	}
+	values, batches := store.snapshot()
+	want := [][]StoreWrite{{{Key: "a", Value: 2}, {Key: "b", Deleted: true}, {Key: "c", Value: int64(5)}}}
+	if !reflect.DeepEqual(batches, want) {
+		t.Errorf("WriteBatch() = %v, want %v", batches, want)
+	}
+	if !reflect.DeepEqual(values, map[string]interface{}{"a": 2, "c": int64(5)}) {
+		t.Errorf("store = %v, want %v", values, map[string]interface{}{"a": 2, "c": int64(5)})
+	}
+}
+
+func TestWriteBehind_Flush(t *testing.T) {
+	tests := []struct {
+		name      string
+		interval  time.Duration
+		batchSize int
+		keys      int
+		want      int
+	}{
+		{name: "size", interval: time.Hour, batchSize: 2, keys: 4, want: 4},
+		{name: "interval", interval: 10 * time.Millisecond, batchSize: 100, keys: 3, want: 3},
+		{name: "pending", interval: time.Hour, batchSize: 100, keys: 3, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			c := NewMemCache(WithWriteBehind(store, tt.interval, tt.batchSize))
+			defer c.Close()
+			for i := 0; i < tt.keys; i++ {
+				c.Set(string(rune('a'+i)), i)
+			}
+			time.Sleep(50 * time.Millisecond)
+			values, batches := store.snapshot()
+			if len(values) != tt.want {
+				t.Errorf("store = %v, want %v keys", values, tt.want)
+			}
+			for _, batch := range batches {
+				if len(batch) > tt.batchSize {
+					t.Errorf("WriteBatch() got %v writes, want at most %v", len(batch), tt.batchSize)
+				}
+			}
+		})
+	}
+}
+
+func TestMemCache_Close(t *testing.T) {
+	errStore := errors.New("store")
+	store := newFakeStore()
+	c := NewMemCache(WithWriteBehind(store, time.Hour, 100))
+	c.Set("a", 1)
+	store.fail(errStore)
+	if err := c.Close(); err != errStore {
+		t.Errorf("Close() = %v, want %v", err, errStore)
+	}
+	if err := c.Close(); err != errStore {
+		t.Errorf("Close() twice = %v, want %v", err, errStore)
+	}
+	if err := NewMemCache().Close(); err != nil {
+		t.Errorf("Close() = %v, want nil", err)
+	}
+}
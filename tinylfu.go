@@ -0,0 +1,251 @@
+package cache
+
+import "container/list"
+
+const (
+	// tinyLFUWindowPercent is the share of the entries kept in the admission window.
+	tinyLFUWindowPercent = 1
+	// tinyLFUProtectedPercent is the share of the main entries kept in the protected segment.
+	tinyLFUProtectedPercent = 80
+	// tinyLFUMinWidth is the smallest number of counters in a row of the frequency sketch.
+	tinyLFUMinWidth = 64
+)
+
+const (
+	segmentWindow uint8 = iota
+	segmentProbation
+	segmentProtected
+)
+
+type tinyLFUEntry[K comparable] struct {
+	key     K
+	segment uint8
+}
+
+// tinyLFUPolicy implements Window-TinyLFU, see https://arxiv.org/abs/1512.00727
+// New keys enter a small LRU window. A key leaving the window is only admitted into the segmented main LRU
+// when the frequency sketch estimates it is used more often than the key the main LRU would evict,
+// so one-off scans can not flush the frequently used keys.
+type tinyLFUPolicy[K comparable] struct {
+	sketch    *cmSketch
+	window    *list.List
+	probation *list.List
+	protected *list.List
+	elems     map[K]*list.Element
+	hash      Hasher[K]
+	// full is set once the cache asked for a victim, before that the window may grow without limit.
+	full bool
+}
+
+// NewTinyLFUPolicy returns an EvictionPolicy implementing Window-TinyLFU.
+// capacity is the number of keys the shard holds, when 0 the frequency sketch grows with the number of tracked keys.
+func NewTinyLFUPolicy(capacity int) EvictionPolicy {
+	return newTinyLFUPolicy[string](capacity, newDefaultHash())
+}
+
+func newTinyLFUPolicy[K comparable](capacity int, hash Hasher[K]) *tinyLFUPolicy[K] {
+	return &tinyLFUPolicy[K]{
+		sketch:    newCMSketch(capacity),
+		window:    list.New(),
+		probation: list.New(),
+		protected: list.New(),
+		elems:     map[K]*list.Element{},
+		hash:      hash,
+	}
+}
+
+func (p *tinyLFUPolicy[K]) OnAccess(k K) {
+	e, ok := p.elems[k]
+	if !ok {
+		return
+	}
+	p.sketch.increment(p.hash.Sum64(k))
+	entry := e.Value.(*tinyLFUEntry[K])
+	switch entry.segment {
+	case segmentWindow:
+		p.window.MoveToFront(e)
+	case segmentProbation:
+		p.probation.Remove(e)
+		entry.segment = segmentProtected
+		p.elems[k] = p.protected.PushFront(entry)
+		p.demote()
+	case segmentProtected:
+		p.protected.MoveToFront(e)
+	}
+}
+
+func (p *tinyLFUPolicy[K]) OnInsert(k K) {
+	if _, ok := p.elems[k]; ok {
+		p.OnAccess(k)
+		return
+	}
+	p.sketch.increment(p.hash.Sum64(k))
+	if len(p.elems) >= p.sketch.width() {
+		p.sketch.grow()
+	}
+	p.elems[k] = p.window.PushFront(&tinyLFUEntry[K]{key: k, segment: segmentWindow})
+	if p.full {
+		// Keep the window within its share, the admission happens when a victim is asked for.
+		for p.window.Len() > p.windowCap()+1 {
+			p.moveToProbation(p.window.Back())
+		}
+	}
+}
+
+func (p *tinyLFUPolicy[K]) OnDelete(k K) {
+	e, ok := p.elems[k]
+	if !ok {
+		return
+	}
+	p.segment(e.Value.(*tinyLFUEntry[K]).segment).Remove(e)
+	delete(p.elems, k)
+}
+
+func (p *tinyLFUPolicy[K]) Victim() (K, bool) {
+	p.full = true
+	if len(p.elems) == 0 {
+		var zero K
+		return zero, false
+	}
+	windowCap := p.windowCap()
+	for p.window.Len() > windowCap+1 {
+		p.moveToProbation(p.window.Back())
+	}
+	mainVictim := p.probation.Back()
+	if mainVictim == nil {
+		mainVictim = p.protected.Back()
+	}
+	if p.window.Len() <= windowCap && mainVictim != nil {
+		return mainVictim.Value.(*tinyLFUEntry[K]).key, true
+	}
+	candidate := p.window.Back()
+	if mainVictim == nil {
+		// The main LRU is empty, admit the candidate and let it compete with the next key of the window.
+		p.moveToProbation(candidate)
+		mainVictim, candidate = p.probation.Back(), p.window.Back()
+		if candidate == nil {
+			return mainVictim.Value.(*tinyLFUEntry[K]).key, true
+		}
+	}
+	candidateKey, victimKey := candidate.Value.(*tinyLFUEntry[K]).key, mainVictim.Value.(*tinyLFUEntry[K]).key
+	if p.sketch.estimate(p.hash.Sum64(candidateKey)) > p.sketch.estimate(p.hash.Sum64(victimKey)) {
+		p.moveToProbation(candidate)
+		return victimKey, true
+	}
+	return candidateKey, true
+}
+
+func (p *tinyLFUPolicy[K]) windowCap() int {
+	if n := len(p.elems) * tinyLFUWindowPercent / 100; n > 1 {
+		return n
+	}
+	return 1
+}
+
+func (p *tinyLFUPolicy[K]) moveToProbation(e *list.Element) {
+	entry := p.window.Remove(e).(*tinyLFUEntry[K])
+	entry.segment = segmentProbation
+	p.elems[entry.key] = p.probation.PushFront(entry)
+}
+
+// demote moves the least recently used protected keys back to probation while the protected segment is over its share.
+func (p *tinyLFUPolicy[K]) demote() {
+	protectedCap := (len(p.elems) - p.window.Len()) * tinyLFUProtectedPercent / 100
+	for p.protected.Len() > protectedCap && p.protected.Len() > 0 {
+		entry := p.protected.Remove(p.protected.Back()).(*tinyLFUEntry[K])
+		entry.segment = segmentProbation
+		p.elems[entry.key] = p.probation.PushFront(entry)
+	}
+}
+
+func (p *tinyLFUPolicy[K]) segment(s uint8) *list.List {
+	switch s {
+	case segmentWindow:
+		return p.window
+	case segmentProbation:
+		return p.probation
+	default:
+		return p.protected
+	}
+}
+
+const cmDepth = 4
+
+// cmSketch is a count-min sketch of 4-bit counters, estimating how often a key was seen.
+// All counters are halved once the number of increments reaches 10 times the width,
+// so that the estimates follow the recent frequency of the keys.
+type cmSketch struct {
+	rows      [cmDepth][]byte
+	mask      uint64
+	additions int
+}
+
+func newCMSketch(capacity int) *cmSketch {
+	width := tinyLFUMinWidth
+	for width < capacity {
+		width <<= 1
+	}
+	s := &cmSketch{mask: uint64(width - 1)}
+	for i := range s.rows {
+		// Two 4-bit counters per byte.
+		s.rows[i] = make([]byte, width/2)
+	}
+	return s
+}
+
+func (s *cmSketch) width() int {
+	return int(s.mask + 1)
+}
+
+// index returns the counter of h in row. Callers remix the hash of the key first with mix64:
+// its low bits pick the shard, so they are the same for all the keys of a shard.
+func (s *cmSketch) index(h uint64, row int) uint64 {
+	h1, h2 := h&0xffffffff, h>>32
+	return (h1 + uint64(row)*h2) & s.mask
+}
+
+func (s *cmSketch) increment(h uint64) {
+	h = mix64(h)
+	for i := range s.rows {
+		idx := s.index(h, i)
+		shift := (idx & 1) * 4
+		if v := (s.rows[i][idx/2] >> shift) & 0x0f; v < 15 {
+			s.rows[i][idx/2] += 1 << shift
+		}
+	}
+	s.additions++
+	if s.additions >= 10*s.width() {
+		s.reset()
+	}
+}
+
+func (s *cmSketch) estimate(h uint64) byte {
+	h = mix64(h)
+	min := byte(15)
+	for i := range s.rows {
+		idx := s.index(h, i)
+		if v := (s.rows[i][idx/2] >> ((idx & 1) * 4)) & 0x0f; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// grow doubles the width of the sketch, keeping the estimates: the counter of a key moves from idx to idx or to
+// idx+width, so both of them start with the value of idx.
+func (s *cmSketch) grow() {
+	for i := range s.rows {
+		s.rows[i] = append(s.rows[i], s.rows[i]...)
+	}
+	s.mask = s.mask<<1 | 1
+}
+
+// reset halves every counter.
+func (s *cmSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] = (s.rows[i][j] >> 1) & 0x77
+		}
+	}
+	s.additions /= 2
+}
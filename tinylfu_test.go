@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// zipfTrace returns n keys drawn from a Zipf distribution over imax keys.
+// Every scanEvery keys, a scan of scanLen keys never seen before is inserted.
+func zipfTrace(seed int64, n int, s float64, imax uint64, scanEvery, scanLen int) []string {
+	r := rand.New(rand.NewSource(seed))
+	z := rand.NewZipf(r, s, 1, imax)
+	trace := make([]string, 0, n)
+	var scanned int
+	for i := 0; i < n; i++ {
+		if scanEvery > 0 && i > 0 && i%scanEvery == 0 {
+			for j := 0; j < scanLen; j++ {
+				trace = append(trace, "scan"+strconv.Itoa(scanned))
+				scanned++
+			}
+		}
+		trace = append(trace, strconv.FormatUint(z.Uint64(), 10))
+	}
+	return trace
+}
+
+// hitRatio replays the trace against a cache of capacity entries in shards, setting the key on every miss.
+func hitRatio(p Policy, shards, capacity int, trace []string) float64 {
+	c := NewMemCache(WithShards(shards), WithMaxEntries(capacity), WithPolicy(p), WithClearInterval(0))
+	var hits int
+	for _, k := range trace {
+		if _, ok := c.Get(k); ok {
+			hits++
+			continue
+		}
+		c.Set(k, struct{}{})
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+func TestTinyLFUPolicy_HitRatio(t *testing.T) {
+	tests := []struct {
+		name     string
+		shards   int
+		capacity int
+		trace    []string
+	}{
+		{name: "zipf 1.01", shards: 1, capacity: 500, trace: zipfTrace(1, 200000, 1.01, 100000, 0, 0)},
+		{name: "zipf 1.2", shards: 1, capacity: 100, trace: zipfTrace(2, 200000, 1.2, 100000, 0, 0)},
+		{name: "zipf with scans", shards: 1, capacity: 500, trace: zipfTrace(3, 200000, 1.01, 100000, 1000, 1000)},
+		{name: "zipf 1.01 16 shards", shards: 16, capacity: 2000, trace: zipfTrace(4, 200000, 1.01, 100000, 0, 0)},
+		{name: "zipf with scans 16 shards", shards: 16, capacity: 2000, trace: zipfTrace(5, 200000, 1.01, 100000, 1000, 1000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lru := hitRatio(PolicyLRU, tt.shards, tt.capacity, tt.trace)
+			tinyLFU := hitRatio(PolicyTinyLFU, tt.shards, tt.capacity, tt.trace)
+			t.Logf("LRU = %.4f, TinyLFU = %.4f", lru, tinyLFU)
+			if tinyLFU <= lru {
+				t.Errorf("TinyLFU hit ratio = %.4f, want more than LRU %.4f", tinyLFU, lru)
+			}
+		})
+	}
+}
+
+func TestTinyLFUPolicy_Victim(t *testing.T) {
+	tests := []struct {
+		name string
+		do   func(p *tinyLFUPolicy[string])
+		want string
+	}{
+		{name: "empty", do: func(p *tinyLFUPolicy[string]) {}, want: ""},
+		{name: "window only", do: func(p *tinyLFUPolicy[string]) {
+			p.OnInsert("a")
+		}, want: "a"},
+		{name: "frequent key is kept", do: func(p *tinyLFUPolicy[string]) {
+			p.OnInsert("a")
+			p.OnAccess("a")
+			p.OnAccess("a")
+			p.OnInsert("b")
+		}, want: "b"},
+		{name: "new key is rejected", do: func(p *tinyLFUPolicy[string]) {
+			p.OnInsert("a")
+			p.OnAccess("a")
+			p.OnInsert("b")
+			p.OnInsert("c")
+			k, _ := p.Victim()
+			p.OnDelete(k)
+			p.OnInsert("d")
+		}, want: "c"},
+		{name: "frequent new key is admitted", do: func(p *tinyLFUPolicy[string]) {
+			p.OnInsert("a")
+			p.OnInsert("b")
+			p.OnInsert("c")
+			k, _ := p.Victim()
+			p.OnDelete(k)
+			p.OnAccess("c")
+			p.OnAccess("c")
+			p.OnInsert("d")
+		}, want: "a"},
+		{name: "deleted key is not a victim", do: func(p *tinyLFUPolicy[string]) {
+			p.OnInsert("a")
+			p.OnInsert("b")
+			p.OnDelete("a")
+		}, want: "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTinyLFUPolicy[string](0, newDefaultHash())
+			tt.do(p)
+			if got, _ := p.Victim(); got != tt.want {
+				t.Errorf("Victim() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCMSketch_Estimate(t *testing.T) {
+	s := newCMSketch(0)
+	h := newDefaultHash()
+	for i := 0; i < 20; i++ {
+		s.increment(h.Sum64("hot"))
+	}
+	s.increment(h.Sum64("cold"))
+	if got := s.estimate(h.Sum64("hot")); got != 15 {
+		t.Errorf("estimate(hot) = %v, want %v", got, 15)
+	}
+	if got := s.estimate(h.Sum64("cold")); got != 1 {
+		t.Errorf("estimate(cold) = %v, want %v", got, 1)
+	}
+	s.reset()
+	if got := s.estimate(h.Sum64("hot")); got != 7 {
+		t.Errorf("estimate(hot) after reset = %v, want %v", got, 7)
+	}
+}
+
+func TestCMSketch_Grow(t *testing.T) {
+	s := newCMSketch(0)
+	h := newDefaultHash()
+	for i := 0; i < 5; i++ {
+		s.increment(h.Sum64("hot"))
+	}
+	s.increment(h.Sum64("cold"))
+	s.grow()
+	if got := s.width(); got != 2*tinyLFUMinWidth {
+		t.Errorf("width() = %v, want %v", got, 2*tinyLFUMinWidth)
+	}
+	if got := s.estimate(h.Sum64("hot")); got != 5 {
+		t.Errorf("estimate(hot) after grow = %v, want %v", got, 5)
+	}
+	if got := s.estimate(h.Sum64("cold")); got != 1 {
+		t.Errorf("estimate(cold) after grow = %v, want %v", got, 1)
+	}
+}
+
+func TestCMSketch_ShardKeys(t *testing.T) {
+	// The keys of a shard share the low bits of their hash, with the default 1024 shards.
+	const shardMask = 1023
+	s := newCMSketch(0)
+	h := newDefaultHash()
+	for i, n := 0, 0; n < s.width(); i++ {
+		if k := h.Sum64(strconv.Itoa(i)); k&shardMask == 0 {
+			s.increment(k)
+			n++
+		}
+	}
+	for row := range s.rows {
+		var used int
+		for _, b := range s.rows[row] {
+			if b&0x0f != 0 {
+				used++
+			}
+			if b&0xf0 != 0 {
+				used++
+			}
+		}
+		if used < s.width()/2 {
+			t.Errorf("row %v uses %v counters of %v, want the keys of a shard spread over the row", row, used, s.width())
+		}
+	}
+}